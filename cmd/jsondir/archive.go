@@ -0,0 +1,182 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// archiveKind returns the kind of archive at name for the -archive mode: "tar", "zip", or the empty
+// string if name isn't walked as an archive.
+func archiveKind(mode, name string) string {
+	if mode != "auto" {
+		return mode
+	}
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"), strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar"
+	}
+	return ""
+}
+
+// openArchive opens the archive at name as an fs.FS. The returned io.Closer must be closed once the
+// archive is no longer needed.
+func openArchive(kind, name string) (fs.FS, io.Closer, error) {
+	if kind == "zip" {
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	fsys, err := readTar(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fsys, io.NopCloser(nil), nil
+}
+
+// tarFS is an in-memory fs.FS of the directories and regular files in a tar archive. Other entries,
+// such as symlinks, are left out.
+type tarFS map[string]*tarEntry
+
+type tarEntry struct {
+	fi       fs.FileInfo
+	data     []byte
+	children []fs.DirEntry
+}
+
+// readTar reads a tar archive, which may be gzipped, from r.
+func readTar(r io.Reader) (tarFS, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	fsys := tarFS{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean("/" + hdr.Name)[1:]
+		if name == "" {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			fsys[name] = &tarEntry{fi: hdr.FileInfo()}
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			fsys[name] = &tarEntry{fi: hdr.FileInfo(), data: data}
+		}
+	}
+
+	names := make([]string, 0, len(fsys))
+	for name := range fsys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fsys["."] = &tarEntry{fi: tarDir(".")}
+	for _, name := range names {
+		fsys.link(name)
+	}
+	return fsys, nil
+}
+
+// tarDir returns the FileInfo of a directory that has no entry of its own in a tar archive.
+func tarDir(name string) fs.FileInfo {
+	return (&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}).FileInfo()
+}
+
+// link adds the entry name to its parent directory, creating the parent if needed.
+func (fsys tarFS) link(name string) {
+	dir := path.Dir(name)
+	parent, ok := fsys[dir]
+	if !ok {
+		parent = &tarEntry{fi: tarDir(dir)}
+		fsys[dir] = parent
+		fsys.link(dir)
+	}
+
+	child := fs.FileInfoToDirEntry(fsys[name].fi)
+	i := sort.Search(len(parent.children), func(i int) bool { return parent.children[i].Name() >= child.Name() })
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+1:], parent.children[i:])
+	parent.children[i] = child
+}
+
+func (fsys tarFS) lookup(op, name string) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := fsys[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (fsys tarFS) Open(name string) (fs.File, error) {
+	e, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &tarFile{e, bytes.NewReader(e.data)}, nil
+}
+
+func (fsys tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.fi.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return append([]fs.DirEntry(nil), e.children...), nil
+}
+
+// tarFile is an open file in a tarFS.
+type tarFile struct {
+	*tarEntry
+	*bytes.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+func (f *tarFile) Close() error               { return nil }
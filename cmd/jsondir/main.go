@@ -0,0 +1,1181 @@
+// Command jsondir converts a directory structure to JSON.
+//
+// jsondir will walk a directory tree and convert its files to what it thinks is an appropriate JSON
+// representation. Boolean values are true/TRUE and false/FALSE, numerics are any normal value
+// handled by strconv.ParseInt, floats any string convertible by strconv.ParseFloat, the string
+// "null" or "NULL" is a null value, and everything else is treated as a string. Numbers with a
+// leading zero are strings unless -auto-base is set.
+//
+// Files ending in an '@' (at sign) are treated as raw JSON values and will be unmarshaled upon
+// loading to verify they're valid. Invalid data is a failure. Files ending in ".yaml@", ".yml@", or
+// ".toml@" are decoded as YAML or TOML instead, and files ending in ".b64@" are base64 that's
+// decoded before the file is read. Files ending in .str, .int, .float, .bool, or .null are always
+// converted to that type, and files ending in .hex, .lines, .csv, .env, .b64, .time, or .dur are
+// read in their format. Directories ending in "[]" are arrays, and a directory ending in '!' takes
+// the value of the only file in it. See the documentation of package go.spiff.io/jsondir, or
+// README.txt, for the details of each suffix.
+//
+// If the -x flag is set, executable files will be run to generate JSON output. This can be used to
+// nest jsondir calls if necessary (e.g., including a separate directory tree).
+//
+// By default, dot files are ignored.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.spiff.io/jsondir"
+)
+
+var logOutput io.Writer = ioutil.Discard
+var errlog = log.New(os.Stderr, "jsondir: ", 0)
+
+// warnlog receives errors that aren't fatal. It's errlog unless -q is set.
+var warnlog = errlog
+
+// output is where results are written. It's stdout unless -o is set, in which case it's a
+// temporary file that replaces the output file once all paths have been written.
+var output io.Writer = os.Stdout
+
+func emit(b []byte) {
+	if _, err := fmt.Fprintf(output, "%s\n", b); err != nil {
+		fatal("unable to write output: ", err)
+	}
+}
+
+// fatal logs its arguments and exits, removing any partially written output file.
+func fatal(v ...interface{}) {
+	if f, ok := output.(*os.File); ok && f != os.Stdout {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	errlog.Fatal(v...)
+}
+
+// openOutput creates the temporary file that output is written to for -o. It's created in the same
+// directory as the output file so that it can be renamed over it.
+func openOutput(name string) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := ioutil.TempFile(dir, "."+base+".")
+	if err != nil {
+		errlog.Fatal("unable to open output file: ", err)
+	}
+	output = f
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(name); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	if err = f.Chmod(mode); err != nil {
+		fatal("unable to open output file: ", err)
+	}
+}
+
+// commitOutput renames the temporary output file over the output file for -o.
+func commitOutput(name string) {
+	f, ok := output.(*os.File)
+	if !ok || f == os.Stdout {
+		return
+	}
+
+	if err := f.Close(); err != nil {
+		fatal("unable to close output file: ", err)
+	}
+
+	if err := os.Rename(f.Name(), name); err != nil {
+		fatal("unable to write output file: ", err)
+	}
+}
+
+type StringSet map[string]struct{}
+
+func (ss StringSet) Has(v string) (ok bool) {
+	_, ok = ss[v]
+	return ok
+}
+
+func (ss StringSet) Set(v string) error {
+	ss[v] = struct{}{}
+	return nil
+}
+
+func (ss StringSet) Strings() (strs []string) {
+	strs = make([]string, len(ss))
+	i := 0
+	for k := range ss {
+		strs[i] = k
+		i++
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func (ss StringSet) String() string {
+	return fmt.Sprint(ss.Strings())
+}
+
+// StringList is a flag.Value that collects every value it's set to, in order.
+type StringList []string
+
+func (sl *StringList) Set(v string) error {
+	*sl = append(*sl, v)
+	return nil
+}
+
+func (sl *StringList) String() string {
+	return fmt.Sprint(*sl)
+}
+
+// ExtList is a flag.Value for a comma-separated list of file extensions, each starting with a '.'.
+// It can be given without a value, like a bool flag, to mean every extension.
+type ExtList struct {
+	All  bool
+	Exts []string
+}
+
+func (el *ExtList) IsBoolFlag() bool {
+	return true
+}
+
+func (el *ExtList) Set(v string) error {
+	if all, err := strconv.ParseBool(v); err == nil {
+		el.All, el.Exts = all, nil
+		return nil
+	}
+
+	el.All, el.Exts = false, nil
+	for _, ext := range strings.Split(v, ",") {
+		if ext = strings.TrimSpace(ext); len(ext) < 2 || ext[0] != '.' {
+			return fmt.Errorf("invalid extension %q: must start with '.'", ext)
+		}
+		el.Exts = append(el.Exts, ext)
+	}
+	return nil
+}
+
+func (el *ExtList) String() string {
+	if el.All {
+		return "true"
+	}
+	return strings.Join(el.Exts, ",")
+}
+
+// ByteSize is a flag.Value for a number of bytes. It may have a K, M, G, or T suffix for a
+// multiple of 1024 bytes, so that 10M is 10 MiB.
+type ByteSize int64
+
+func (bs *ByteSize) Set(v string) error {
+	mul := int64(1)
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'k', 'K':
+			mul = 1 << 10
+		case 'm', 'M':
+			mul = 1 << 20
+		case 'g', 'G':
+			mul = 1 << 30
+		case 't', 'T':
+			mul = 1 << 40
+		}
+		if mul > 1 {
+			v = v[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mul {
+		return errors.New("must be a non-negative number of bytes, optionally with a K, M, G, or T suffix")
+	}
+	*bs = ByteSize(n * mul)
+	return nil
+}
+
+func (bs *ByteSize) String() string {
+	return strconv.FormatInt(int64(*bs), 10)
+}
+
+var (
+	ignorePatterns  StringList
+	execEnv         StringList
+	execExts        StringList
+	stripExts       ExtList
+	keyMap          StringList
+	timeLayouts     StringList
+	includePatterns = make(StringSet)
+	maxSize         ByteSize
+
+	verbose        = flag.Bool("v", false, "Enable log messages.")
+	quiet          = flag.Bool("q", false, "Only log fatal errors.")
+	compact        = flag.Bool("c", !isTTY(), "Whether to emit compact JSON.")
+	followSymlinks = flag.Bool("s", false, "Whether to follow symlinks.")
+	followFiles    = flag.Bool("sf", false, "Follow symlinks to files, but not to directories.")
+	symlinkMeta    = flag.Bool("symlink-meta", false, "Represent symlinks that aren't followed by an object describing their target.")
+	keepWhitespace = flag.Bool("ws", false, "Keep trailing whitespace in uninterpolated strings.")
+	trimSpace      = flag.Bool("trim", false, "Trim leading whitespace from files as well as trailing whitespace.")
+	lf             = flag.Bool("lf", false, "Convert CRLF line endings in files to LF.")
+	rawStrings     = flag.Bool("raw-strings", false, "Read all files as strings instead of inferring their types.")
+	nullEmpty      = flag.Bool("null-empty", false, "Read empty files as null instead of an empty string. Shorthand for -empty null.")
+	nullTokens     = flag.String("null", "null,NULL", "Comma-separated `tokens` read as null.")
+	trueTokens     = flag.String("true", "true,TRUE", "Comma-separated `tokens` read as true.")
+	falseTokens    = flag.String("false", "false,FALSE", "Comma-separated `tokens` read as false.")
+	durUnit        = flag.String("dur-unit", "string", "Write .dur files as a string, or an integer count of ns, us, ms, s, m, or h.")
+	parseTime      = flag.Bool("time", false, "Normalize files containing a time to RFC 3339 in UTC.")
+	emptyDirMode   = flag.String("empty-dir", "keep", "How to represent empty directories: keep, object, array, null, or skip.")
+	emptyMode      = flag.String("empty", "string", "How to represent empty files: string, null, or skip.")
+	oversizeMode   = flag.String("max-size-mode", "skip", "What to do with files larger than -max-size: skip, error, or truncate.")
+	keyCaseMode    = flag.String("key-case", "keep", "Convert keys to a `case`: keep, camel, snake, kebab, lower, or upper.")
+	dupMode        = flag.String("dup", "last", "Which file to use when files have the same key: first, last, or error.")
+	gzipFiles      = flag.Bool("gz", false, "Decompress files ending in .gz and read them as if they didn't end in it.")
+	binaryMode     = flag.String("binary", "string", "How to represent binary files: string, base64, skip, or error.")
+	autoBase       = flag.Bool("auto-base", false, "Parse numbers with a leading zero as octal, hex, or binary instead of as strings.")
+	leadingZero    = flag.Bool("preserve-leading-zero", true, "Read numbers with a leading zero as strings. The inverse of -auto-base.")
+	intBase        = flag.Int("base", 0, "Read integers in `base` 2, 8, 10, or 16. 0 is the same as -auto-base.")
+	numUnderscore  = flag.Bool("num-underscore", false, "Allow underscores between the digits of numbers, as in 1_000.")
+	numRaw         = flag.Bool("num-raw", false, "Keep numbers exactly as written instead of converting them to integers or floats.")
+	hexStrings     = flag.Bool("hex-str", false, "Keep .hex files, and 0x numbers with -auto-base, as strings as written.")
+	allowExecute   = flag.Bool("x", false, "Allow execution of executable files to generate content.")
+	noTmpExec      = flag.Bool("nt", false, "Don't execute files from a temporary directory.")
+	relExec        = flag.Bool("rx", false, "Execute files in their directory (instead of pwd or tmp - implies -nt).")
+	execJSON       = flag.Bool("xjson", false, "Parse the output of executables as JSON.")
+	execArgs       = flag.Bool("xargs", false, "Pass executables their path, key, and the path being walked as arguments.")
+	execStdin      = flag.Bool("x-stdin", false, "Give executables their own contents on standard input.")
+	execStdinFile  = flag.String("x-stdin-file", "", "Give executables the contents of `file` on standard input (implies -x-stdin).")
+	execSkipCode   = flag.Int("x-skip-code", 65, "Skip executables that exit with `status` instead of failing.")
+	execTimeout    = flag.Duration("x-timeout", 0, "Kill executables that run longer than `duration`. Zero means no timeout.")
+	csvDelim       = flag.String("csv-delim", ",", "The field delimiter `character` of .csv files.")
+	strict         = flag.Bool("strict", false, "Fail instead of skipping symlinks, cycles, invalid file names, and executables that exit with -x-skip-code.")
+	keepGoing      = flag.Bool("keep-going", false, "Leave out files that fail instead of stopping, and report every failure at the end.")
+	rawKeys        = flag.Bool("raw-keys", false, "Use file names as keys without trimming suffixes such as @, [], and {}.")
+	defaultArray   = flag.Bool("default-array", false, "Make directories arrays unless their names end in {}.")
+	dotKeys        = flag.Bool("dotkeys", false, "Nest files with a '.' in their keys in objects, so that db.host is {\"db\": {\"host\": ...}}.")
+	natsort        = flag.Bool("natsort", false, "Order array elements naturally, comparing numbers in their names by value.")
+	dryRun         = flag.Bool("dry", false, "Describe how each file would be converted on stderr instead of writing output.")
+	meta           = flag.Bool("meta", false, "Wrap file values in objects with their mode, size, and mtime.")
+	execCache      = flag.String("xcache", "", "Cache the output of executables in `dir` and reuse it while they're unchanged.")
+	skipTimeout    = flag.Bool("x-timeout-skip", false, "Skip executables that time out instead of failing.")
+	timeout        = flag.Duration("timeout", 0, "Give up on walking all paths after `duration`. Zero means no timeout.")
+	emitYAML       = flag.Bool("y", false, "Emit YAML instead of JSON. Shorthand for -format yaml.")
+	format         = flag.String("format", "json", "The output `format`: json, ndjson (or jsonl), yaml, or env.")
+	jobs           = flag.Int("j", runtime.NumCPU(), "Walk up to `N` directory entries concurrently.")
+	dotfiles       = flag.Bool("dotfiles", false, "Don't ignore files beginning with '.' by default.")
+	gitignore      = flag.Bool("gitignore", false, "Read ignore patterns from .jsondirignore and .gitignore files in each directory.")
+	maxDepth       = flag.Int("depth", 0, "Walk at most `N` directory levels, so 1 is only a path's immediate children. Zero or less is unlimited.")
+	depthMode      = flag.String("depth-mode", "omit", "How to represent directories beyond -depth: omit, null, or empty.")
+	outputFile     = flag.String("o", "", "Write output to `file` instead of stdout.")
+	manifestFile   = flag.String("manifest", "", "Write a JSON object mapping the JSON Pointer of each value to its source path to `file`.")
+	indent         = flag.String("indent", "\t", "Indent non-compact JSON with `string`, which may only contain whitespace.")
+	indentSpaces   = flag.Int("indent-spaces", 0, "Indent non-compact JSON with `N` spaces instead of -indent.")
+	noEscapeHTML   = flag.Bool("no-escape-html", false, "Don't escape <, >, and & in JSON strings.")
+	ndjson         = flag.Bool("ndjson", false, "Emit each element of a top-level array as its own line of compact JSON.")
+	pathsFrom      = flag.String("paths-from", "", "Read newline-separated paths to walk from `file` (or stdin, if \"-\"), after any arguments.")
+	stdinPaths     = flag.Bool("stdin", false, "Read newline-separated paths to walk from stdin. Shorthand for -paths-from -.")
+	nulPaths       = flag.Bool("0", false, "Paths read by -paths-from are separated by NUL bytes instead of newlines.")
+	merge          = flag.Bool("merge", false, "Write a single object with the result of each path, keyed by its base name.")
+	mergeFullPath  = flag.Bool("merge-full-path", false, "Key -merge results by their full path instead of their base name.")
+	rootKey        = flag.String("root-key", "", "Wrap each result in an object with the key `name`.")
+	flattenKeys    = flag.Bool("flatten", false, "Write each result as a flat object whose keys are the paths to its values, such as db.port.")
+	flattenSep     = flag.String("flatten-sep", ".", "The `separator` of the keys in a path for -flatten.")
+	arrayResults   = flag.Bool("array", false, "Write a single array with the result of each path.")
+	overlay        = flag.Bool("overlay", false, "Deep-merge the results of all paths into one, with later paths taking precedence.")
+	mergeArrays    = flag.String("merge-arrays", "replace", "How -overlay merges arrays: replace, or concat to append later arrays to earlier ones.")
+	archiveMode    = flag.String("archive", "", "Walk the contents of archive files of the given `kind`: tar, zip, or auto to detect it by extension.")
+	unpackDir      = flag.String("unpack", "", "Read a JSON document from the given file (or stdin) and write it out as a directory tree at `path`.")
+)
+
+func init() {
+	flag.BoolVar(rawStrings, "S", false, "Shorthand for -raw-strings.")
+	flag.BoolVar(numRaw, "jsonnumber", false, "Alias for -num-raw.")
+	flag.BoolVar(autoBase, "octal", false, "Alias for -auto-base.")
+	flag.BoolVar(parseTime, "dates", false, "Alias for -time.")
+	flag.StringVar(unpackDir, "r", "", "Alias for -unpack (reverse mode).")
+	flag.DurationVar(execTimeout, "xtimeout", 0, "Alias for -x-timeout.")
+	flag.StringVar(execCache, "x-cache", "", "Alias for -xcache.")
+	flag.Var(&timeLayouts, "time-layout", "Parse times with the Go time `layout` instead of the defaults. May be repeated.")
+	flag.Var(&maxSize, "max-size", "Limit files and executable output to `size` bytes, which may have a K, M, G, or T suffix. Zero is unlimited.")
+	flag.Var(&stripExts, "strip-ext", "Trim extensions from the keys of files, or only those in the comma-separated `list` if given with '='.")
+	flag.Var(&keyMap, "keymap", "Give files whose names match `PATTERN=KEY` the key KEY. May be repeated.")
+	flag.Var(&execExts, "x-ext", "Run files ending in `EXT[=COMMAND]` as executables, using COMMAND if given. May be comma-separated or repeated.")
+	flag.Var(&execEnv, "x-env", "Set the environment variable `KEY=VALUE` for executables. May be repeated.")
+	flag.Var(includePatterns, "include", "Specify a `pattern` to include. If given, only files matching an include pattern are walked.")
+	flag.Var(includePatterns, "I", "Shorthand for -include.")
+	flag.Var(&ignorePatterns, "i", "Specify a `pattern` to ignore, or to re-include if prefixed with '!'. Uses filepath.Match. Defaults to files beginning with '.'.")
+}
+
+func main() {
+	log.SetPrefix("jsondir: ")
+	log.SetFlags(0)
+
+	flag.Parse()
+
+	if *verbose && *quiet {
+		errlog.Fatal("-v and -q cannot be used together")
+	} else if *verbose {
+		logOutput = os.Stderr
+	} else if *quiet {
+		warnlog = log.New(ioutil.Discard, "", 0)
+	}
+
+	log.SetOutput(logOutput)
+
+	if *outputFile != "" && !isFlagSet("c") {
+		// Output to a file is never to a terminal, so default to compact output.
+		*compact = true
+	}
+
+	if *emitYAML {
+		if isFlagSet("format") && *format != "yaml" {
+			errlog.Fatal("-y and -format ", *format, " cannot be used together")
+		}
+		*format = "yaml"
+	}
+
+	switch *format {
+	case "json":
+	case "ndjson", "jsonl":
+		*format, *ndjson = "json", true
+	case "yaml":
+		if *ndjson {
+			errlog.Fatal("-ndjson cannot be used with YAML output")
+		}
+	case "env":
+		if *ndjson {
+			errlog.Fatal("-ndjson cannot be used with env output")
+		}
+	default:
+		errlog.Fatalf("invalid -format %q: must be json, ndjson, jsonl, yaml, or env", *format)
+	}
+
+	if strings.TrimSpace(*indent) != "" {
+		errlog.Fatalf("invalid -indent %q: must only contain whitespace", *indent)
+	}
+
+	if isFlagSet("indent-spaces") {
+		if isFlagSet("indent") {
+			errlog.Fatal("-indent and -indent-spaces cannot be used together")
+		} else if *indentSpaces < 0 {
+			errlog.Fatal("invalid -indent-spaces ", *indentSpaces, ": must not be negative")
+		}
+		*indent = strings.Repeat(" ", *indentSpaces)
+	}
+
+	delim, size := utf8.DecodeRuneInString(*csvDelim)
+	if *csvDelim == "\\t" {
+		delim, size = '\t', 2
+	}
+	if size != len(*csvDelim) || delim == utf8.RuneError {
+		errlog.Fatalf("invalid -csv-delim %q: must be a single character", *csvDelim)
+	}
+
+	if *nullEmpty {
+		if isFlagSet("empty") && *emptyMode != "null" {
+			errlog.Fatal("-null-empty and -empty ", *emptyMode, " cannot be used together")
+		}
+		*emptyMode = "null"
+	}
+
+	var empty jsondir.EmptyMode
+	switch *emptyMode {
+	case "string":
+		empty = jsondir.EmptyString
+	case "null":
+		empty = jsondir.EmptyNull
+	case "skip":
+		empty = jsondir.EmptySkip
+	default:
+		errlog.Fatalf("invalid -empty %q: must be string, null, or skip", *emptyMode)
+	}
+
+	if *execSkipCode < 1 || *execSkipCode > 255 {
+		errlog.Fatalf("invalid -x-skip-code %d: must be from 1 to 255", *execSkipCode)
+	}
+
+	if isFlagSet("preserve-leading-zero") {
+		if *leadingZero && *autoBase {
+			errlog.Fatal("-auto-base and -preserve-leading-zero cannot be used together")
+		}
+		*autoBase = *autoBase || !*leadingZero
+	}
+
+	switch *intBase {
+	case 0:
+		if isFlagSet("base") {
+			*autoBase = true
+		}
+	case 2, 8, 10, 16:
+		if *autoBase {
+			errlog.Fatal("-auto-base and -base ", *intBase, " cannot be used together")
+		}
+	default:
+		errlog.Fatalf("invalid -base %d: must be 0, 2, 8, 10, or 16", *intBase)
+	}
+
+	var oversize jsondir.OversizeMode
+	switch *oversizeMode {
+	case "skip":
+		oversize = jsondir.OversizeSkip
+	case "error":
+		oversize = jsondir.OversizeError
+	case "truncate":
+		oversize = jsondir.OversizeTruncate
+	default:
+		errlog.Fatalf("invalid -max-size-mode %q: must be skip, error, or truncate", *oversizeMode)
+	}
+
+	durUnits := map[string]time.Duration{
+		"string": 0,
+		"ns":     time.Nanosecond,
+		"us":     time.Microsecond,
+		"ms":     time.Millisecond,
+		"s":      time.Second,
+		"m":      time.Minute,
+		"h":      time.Hour,
+	}
+	durationUnit, ok := durUnits[*durUnit]
+	if !ok {
+		errlog.Fatalf("invalid -dur-unit %q: must be string, ns, us, ms, s, m, or h", *durUnit)
+	}
+
+	var keyCase jsondir.KeyCaseMode
+	switch *keyCaseMode {
+	case "keep":
+		keyCase = jsondir.KeyCaseKeep
+	case "camel":
+		keyCase = jsondir.KeyCaseCamel
+	case "snake":
+		keyCase = jsondir.KeyCaseSnake
+	case "kebab":
+		keyCase = jsondir.KeyCaseKebab
+	case "lower":
+		keyCase = jsondir.KeyCaseLower
+	case "upper":
+		keyCase = jsondir.KeyCaseUpper
+	default:
+		errlog.Fatalf("invalid -key-case %q: must be keep, camel, snake, kebab, lower, or upper", *keyCaseMode)
+	}
+
+	var duplicates jsondir.DuplicateMode
+	switch *dupMode {
+	case "last":
+		duplicates = jsondir.DuplicateLast
+	case "first":
+		duplicates = jsondir.DuplicateFirst
+	case "error":
+		duplicates = jsondir.DuplicateError
+	default:
+		errlog.Fatalf("invalid -dup %q: must be first, last, or error", *dupMode)
+	}
+
+	var binary jsondir.BinaryMode
+	switch *binaryMode {
+	case "string":
+		binary = jsondir.BinaryString
+	case "base64":
+		binary = jsondir.BinaryBase64
+	case "skip":
+		binary = jsondir.BinarySkip
+	case "error":
+		binary = jsondir.BinaryError
+	default:
+		errlog.Fatalf("invalid -binary %q: must be string, base64, skip, or error", *binaryMode)
+	}
+
+	var emptyDir jsondir.EmptyDirMode
+	switch *emptyDirMode {
+	case "keep":
+		emptyDir = jsondir.EmptyDirKeep
+	case "object":
+		emptyDir = jsondir.EmptyDirObject
+	case "array":
+		emptyDir = jsondir.EmptyDirArray
+	case "null":
+		emptyDir = jsondir.EmptyDirNull
+	case "skip":
+		emptyDir = jsondir.EmptyDirSkip
+	default:
+		errlog.Fatalf("invalid -empty-dir %q: must be keep, object, array, null, or skip", *emptyDirMode)
+	}
+
+	var beyondDepth jsondir.DepthMode
+	switch *depthMode {
+	case "omit":
+		beyondDepth = jsondir.DepthOmit
+	case "null":
+		beyondDepth = jsondir.DepthNull
+	case "empty":
+		beyondDepth = jsondir.DepthEmpty
+	default:
+		errlog.Fatalf("invalid -depth-mode %q: must be omit, null, or empty", *depthMode)
+	}
+
+	switch *archiveMode {
+	case "", "tar", "zip", "auto":
+	default:
+		errlog.Fatalf("invalid -archive %q: must be tar, zip, or auto", *archiveMode)
+	}
+
+	var exts map[string]string
+	for _, list := range execExts {
+		for _, ext := range strings.Split(list, ",") {
+			ext, command := strings.TrimSpace(ext), ""
+			if i := strings.IndexByte(ext, '='); i >= 0 {
+				ext, command = ext[:i], ext[i+1:]
+			}
+			if len(ext) < 2 || ext[0] != '.' {
+				errlog.Fatalf("invalid -x-ext %q: must be an extension starting with '.'", ext)
+			}
+			if exts == nil {
+				exts = make(map[string]string)
+			}
+			exts[ext] = command
+		}
+	}
+
+	for _, kv := range execEnv {
+		if strings.IndexByte(kv, '=') <= 0 {
+			errlog.Fatalf("invalid -x-env %q: must be KEY=VALUE", kv)
+		}
+	}
+
+	if len(ignorePatterns) == 0 && !*dotfiles {
+		ignorePatterns.Set(".*")
+	}
+
+	patterns := ignorePatterns[:0]
+	for _, s := range ignorePatterns {
+		if s == "" || s == "!" {
+			continue
+		}
+
+		if _, err := filepath.Match(strings.TrimPrefix(s, "!"), "."); err != nil {
+			errlog.Fatalf("invalid ignore pattern %q: %v", s, err)
+		}
+		patterns = append(patterns, s)
+	}
+
+	opts := jsondir.Options{
+		FollowSymlinks:     *followSymlinks,
+		FollowFileSymlinks: *followFiles,
+		SymlinkMeta:        *symlinkMeta,
+		KeepWhitespace:     *keepWhitespace,
+		TrimSpace:          *trimSpace,
+		NormalizeNewlines:  *lf,
+		RawStrings:         *rawStrings,
+		NullTokens:         splitTokens(*nullTokens),
+		TrueTokens:         splitTokens(*trueTokens),
+		FalseTokens:        splitTokens(*falseTokens),
+		ParseTime:          *parseTime,
+		TimeLayouts:        timeLayouts,
+		DurationUnit:       durationUnit,
+		Empty:              empty,
+		Binary:             binary,
+		EmptyDir:           emptyDir,
+		AutoBase:           *autoBase,
+		IntBase:            *intBase,
+		NumUnderscore:      *numUnderscore,
+		UseNumber:          *numRaw,
+		HexStrings:         *hexStrings,
+		CSVDelimiter:       delim,
+		Strict:             *strict,
+		MaxSize:            int64(maxSize),
+		Duplicates:         duplicates,
+		Oversize:           oversize,
+		AllowExecute:       *allowExecute,
+		NoTempExec:         *noTmpExec,
+		RelativeExec:       *relExec,
+		ExecJSON:           *execJSON,
+		ExecEnv:            execEnv,
+		ExecExts:           exts,
+		ExecArgs:           *execArgs,
+		ExecStdin:          *execStdin,
+		ExecStdinFile:      *execStdinFile,
+		ExecTimeout:        *execTimeout,
+		ExecCacheDir:       *execCache,
+		ExecSkipCode:       *execSkipCode,
+		SkipExecTimeout:    *skipTimeout,
+		Meta:               *meta,
+		NaturalSort:        *natsort,
+		DotKeys:            *dotKeys,
+		StripExt:           stripExts.All,
+		StripExts:          stripExts.Exts,
+		KeyMap:             keyMap,
+		DefaultArray:       *defaultArray,
+		KeyCase:            keyCase,
+		Gzip:               *gzipFiles,
+		RawKeys:            *rawKeys,
+		Jobs:               *jobs,
+		MaxDepth:           *maxDepth,
+		BeyondDepth:        beyondDepth,
+		IgnorePatterns:     patterns,
+		IncludePatterns:    includePatterns.Strings(),
+		IgnoreFiles:        ignoreFiles(),
+		KeepGoing:          *keepGoing,
+		Log:                log.New(logOutput, "jsondir: ", 0),
+		ErrorLog:           warnlog,
+	}
+
+	if *unpackDir != "" {
+		unpack(*unpackDir, opts)
+		return
+	}
+
+	if *dryRun {
+		opts.DryRun = os.Stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		// Restore the default behavior after the first interrupt, so that another one exits.
+		<-ctx.Done()
+		stop()
+	}()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if *stdinPaths && *pathsFrom != "" && *pathsFrom != "-" {
+		errlog.Fatal("-stdin and -paths-from ", *pathsFrom, " cannot be used together")
+	}
+
+	if *merge && *overlay || *arrayResults && (*merge || *overlay) {
+		errlog.Fatal("only one of -array, -merge, and -overlay may be used")
+	}
+
+	if *mergeArrays != "replace" && *mergeArrays != "concat" {
+		errlog.Fatalf("invalid -merge-arrays %q: must be replace or concat", *mergeArrays)
+	}
+
+	if *manifestFile != "" && *dryRun {
+		errlog.Fatal("-manifest cannot be used with -dry")
+	} else if *manifestFile != "" && (*flattenKeys || *format == "env") {
+		errlog.Fatal("-manifest cannot be used with -flatten or -format env")
+	} else if *manifestFile != "" && *overlay && *mergeArrays == "concat" {
+		errlog.Fatal("-manifest cannot be used with -overlay and -merge-arrays concat")
+	}
+
+	if *outputFile != "" && !*dryRun {
+		openOutput(*outputFile)
+	}
+
+	var manifest map[string]string
+	if *manifestFile != "" {
+		manifest = make(map[string]string)
+	}
+
+	var failed jsondir.Errors
+	var merged map[string]interface{}
+	if *merge {
+		merged = make(map[string]interface{})
+	}
+
+	var overlaid interface{}
+	overlays := 0
+	ary := []interface{}{}
+
+	for _, p := range inputPaths() {
+		if manifest != nil {
+			opts.Manifest = make(map[string]string)
+		}
+		data, err := walk(ctx, p, opts)
+		if errs, ok := err.(jsondir.Errors); ok {
+			failed, err = append(failed, errs...), nil
+		}
+
+		switch {
+		case err == context.DeadlineExceeded:
+			fatal("timed out after ", *timeout, " walking path ", p)
+		case err == context.Canceled:
+			fatal("interrupted walking path ", p)
+		case jsondir.IsSkip(err):
+			log.Print(err)
+			continue
+		case err != nil:
+			fatal("unable to walk path ", p, ": ", err)
+		}
+
+		if *dryRun {
+			continue
+		}
+
+		if *arrayResults {
+			addManifest(manifest, "/"+strconv.Itoa(len(ary)), opts.Manifest)
+			ary = append(ary, data)
+			continue
+		}
+
+		if *overlay {
+			addManifest(manifest, "", opts.Manifest)
+			if overlays == 0 {
+				overlaid = data
+			} else if overlaid, err = mergeValue(overlaid, data, *mergeArrays == "concat", nil); err != nil {
+				fatal("unable to overlay path ", p, ": ", err)
+			}
+			overlays++
+			continue
+		}
+
+		if merged == nil {
+			if manifest != nil && results > 0 {
+				fatal("-manifest requires -array, -merge, or -overlay to walk more than one path")
+			}
+			addManifest(manifest, "", opts.Manifest)
+			writeResult(p, data)
+			continue
+		}
+
+		key := p
+		if !*mergeFullPath {
+			key = filepath.Base(p)
+		}
+		if _, ok := merged[key]; ok {
+			fatal("unable to merge path ", p, ": key ", key, " is already used by another path")
+		}
+		merged[key] = data
+		addManifest(manifest, "/"+jsondir.PointerToken(key), opts.Manifest)
+	}
+
+	if *dryRun {
+		return
+	}
+
+	if merged != nil {
+		writeResult("merged paths", merged)
+	}
+
+	if overlays > 0 {
+		writeResult("overlaid paths", overlaid)
+	}
+
+	if *arrayResults {
+		writeResult("paths", ary)
+	}
+
+	commitOutput(*outputFile)
+
+	if manifest != nil {
+		writeManifest(*manifestFile, manifest)
+	}
+
+	if len(failed) > 0 {
+		for _, err := range failed {
+			errlog.Print(err.Path, ": ", err.Err)
+		}
+		errlog.Fatal(len(failed), " files failed")
+	}
+}
+
+// splitTokens splits a comma-separated list of tokens for -null, -true, and -false. Whitespace
+// around each token is trimmed, and an empty list has no tokens.
+func splitTokens(s string) []string {
+	tokens := []string{}
+	for _, tok := range strings.Split(s, ",") {
+		if tok = strings.TrimSpace(tok); tok != "" {
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
+
+// addManifest adds the entries of src, the manifest of one path, to dst with their pointers
+// prefixed by prefix.
+func addManifest(dst map[string]string, prefix string, src map[string]string) {
+	for ptr, path := range src {
+		dst[prefix+ptr] = path
+	}
+}
+
+// writeManifest writes manifest to the file name for -manifest.
+func writeManifest(name string, manifest map[string]string) {
+	if *rootKey != "" {
+		prefixed := make(map[string]string, len(manifest))
+		addManifest(prefixed, "/"+jsondir.PointerToken(*rootKey), manifest)
+		manifest = prefixed
+	}
+
+	b, err := marshalJSON(manifest, !*compact)
+	if err != nil {
+		fatal("unable to marshal manifest: ", err)
+	}
+	if err = ioutil.WriteFile(name, append(b, '\n'), 0644); err != nil {
+		fatal("unable to write manifest: ", err)
+	}
+}
+
+// results is the number of results written by writeResult.
+var results int
+
+// writeResult writes the result of walking the path p to output. Object keys are sorted by both
+// encoding/json and marshalYAML, so output is always in a canonical order.
+func writeResult(p string, data interface{}) {
+	defer func() { results++ }()
+
+	if *rootKey != "" {
+		data = map[string]interface{}{*rootKey: data}
+	}
+
+	if *format == "env" {
+		writeEnv(p, data)
+		return
+	}
+
+	if ary, ok := data.([]interface{}); ok && *ndjson {
+		for _, elem := range ary {
+			b, err := marshalJSON(flattenResult(p, elem), false)
+			if err != nil {
+				fatal("unable to marshal result ", p, ": ", err)
+			}
+			emit(b)
+		}
+		return
+	}
+
+	data = flattenResult(p, data)
+
+	var b []byte
+	var err error
+	if *format == "yaml" {
+		if results > 0 {
+			emit([]byte("---"))
+		}
+		b, err = marshalYAML(data, *compact)
+	} else {
+		b, err = marshalJSON(data, !*compact && !*ndjson)
+	}
+	if err != nil {
+		fatal("unable to marshal result ", p, ": ", err)
+	}
+
+	emit(b)
+}
+
+// flattenResult returns data, the result of walking the path p, as a flat object if -flatten is
+// set. Scalars are returned as they are.
+func flattenResult(p string, data interface{}) interface{} {
+	if !*flattenKeys {
+		return data
+	}
+	switch data.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return data
+	}
+
+	flat := make(map[string]interface{})
+	if err := flatten(flat, "", *flattenSep, data); err != nil {
+		fatal("unable to flatten result ", p, ": ", err)
+	}
+	return flat
+}
+
+// flatten adds the values nested in the object or array v to flat, with keys that join the keys
+// and indices of the path to each value from prefix with sep. Empty objects and arrays are kept as
+// values.
+func flatten(flat map[string]interface{}, prefix, sep string, v interface{}) error {
+	key := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + sep + k
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if err := flattenValue(flat, key(k), sep, elem); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			if err := flattenValue(flat, key(strconv.Itoa(i)), sep, elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flattenValue adds v to flat at key, or the values nested in it if it's a non-empty object or
+// array. It's an error for key to already be in flat.
+func flattenValue(flat map[string]interface{}, key, sep string, v interface{}) error {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if len(c) > 0 {
+			return flatten(flat, key, sep, v)
+		}
+	case []interface{}:
+		if len(c) > 0 {
+			return flatten(flat, key, sep, v)
+		}
+	}
+
+	if _, ok := flat[key]; ok {
+		return fmt.Errorf("duplicate key %q", key)
+	}
+	flat[key] = v
+	return nil
+}
+
+// writeEnv writes data, the result of walking the path p, as shell variable assignments for
+// -format env, one per line and sorted by name. data is flattened with '_' between keys, and each
+// key is made a valid variable name.
+func writeEnv(p string, data interface{}) {
+	switch data.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		fatal("unable to write result ", p, " as env: must be an object or array")
+	}
+
+	flat := make(map[string]interface{})
+	if err := flatten(flat, "", "_", data); err != nil {
+		fatal("unable to write result ", p, " as env: ", err)
+	}
+
+	vars := make(map[string]string, len(flat))
+	names := make([]string, 0, len(flat))
+	for key, v := range flat {
+		name := envName(key)
+		if _, ok := vars[name]; ok {
+			fatal("unable to write result ", p, " as env: duplicate variable ", name)
+		}
+
+		switch v := v.(type) {
+		case nil:
+			vars[name] = ""
+		case string:
+			vars[name] = v
+		default:
+			b, err := marshalJSON(v, false)
+			if err != nil {
+				fatal("unable to marshal result ", p, ": ", err)
+			}
+			vars[name] = string(b)
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		emit([]byte(name + "=" + shellQuote(vars[name])))
+	}
+}
+
+// envName returns key as a shell variable name: uppercase, with every character other than an
+// ASCII letter, digit, or underscore replaced by an underscore, and an underscore prepended if it
+// would start with a digit.
+func envName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+	return string(name)
+}
+
+// shellQuote returns s quoted for a POSIX shell with single quotes, unless it's non-empty and
+// only contains characters that never need quoting.
+func shellQuote(s string) string {
+	safe := s != ""
+	for i := 0; i < len(s) && safe; i++ {
+		c := s[i]
+		safe = c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.IndexByte("_-.,:/@%+=", c) >= 0
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// marshalJSON returns the JSON encoding of v, indented with -indent if pretty is true.
+func marshalJSON(v interface{}, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!*noEscapeHTML)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if !pretty {
+		return b, nil
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", *indent); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// inputPaths returns the paths to walk: the arguments followed by any paths read from -paths-from.
+func inputPaths() []string {
+	paths := flag.Args()
+	if *stdinPaths {
+		*pathsFrom = "-"
+	}
+	if *pathsFrom == "" {
+		return paths
+	}
+
+	var r io.Reader = os.Stdin
+	if *pathsFrom != "-" {
+		f, err := os.Open(*pathsFrom)
+		if err != nil {
+			fatal("unable to open -paths-from file: ", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	if *nulPaths {
+		scanner.Split(scanNUL)
+	}
+	for scanner.Scan() {
+		p := scanner.Text()
+		if !*nulPaths {
+			p = strings.TrimSpace(p)
+		}
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fatal("unable to read paths: ", err)
+	}
+	return paths
+}
+
+// scanNUL is a bufio.SplitFunc for NUL-terminated tokens.
+func scanNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// walk converts the file or directory at p, or the contents of the archive at p if it's walked as
+// one, to a value.
+func walk(ctx context.Context, p string, opts jsondir.Options) (interface{}, error) {
+	kind := archiveKind(*archiveMode, p)
+	if kind == "" {
+		return jsondir.WalkContext(ctx, p, opts)
+	}
+
+	fsys, closer, err := openArchive(kind, p)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return jsondir.WalkFSContext(ctx, fsys, ".", opts)
+}
+
+// isFlagSet returns whether the flag with the given name was set on the command line.
+func isFlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+func ignoreFiles() []string {
+	if !*gitignore {
+		return nil
+	}
+	return []string{".jsondirignore", ".gitignore"}
+}
+
+// unpack reads a single JSON document from the file named by the only argument, or stdin if there
+// is no argument or it is "-", and writes it out as a directory tree at dst.
+func unpack(dst string, opts jsondir.Options) {
+	// These change keys or wrap values in ways that can't be reversed, or only apply to walking
+	// and writing output.
+	conflicts := map[string]bool{
+		"raw-keys": true, "key-case": true, "strip-ext": true, "keymap": true, "dotkeys": true,
+		"gz": true, "meta": true, "x": true, "dry": true, "o": true, "manifest": true,
+		"format": true, "y": true, "ndjson": true, "merge": true, "merge-full-path": true,
+		"array": true, "overlay": true, "flatten": true, "root-key": true, "paths-from": true,
+		"stdin": true, "archive": true, "timeout": true,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if conflicts[f.Name] {
+			errlog.Fatal("-", f.Name, " cannot be used with -unpack")
+		}
+	})
+
+	var r io.Reader = os.Stdin
+	switch args := flag.Args(); {
+	case len(args) > 1:
+		errlog.Fatal("-unpack accepts at most one input file")
+	case len(args) == 1 && args[0] != "-":
+		f, err := os.Open(args[0])
+		if err != nil {
+			errlog.Fatal("unable to open input: ", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var data interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		errlog.Fatal("unable to decode input: ", err)
+	}
+
+	if dec.More() {
+		errlog.Fatal("unable to decode input: more than one JSON value")
+	}
+
+	path, err := jsondir.Unpack(dst, data, opts)
+	if err != nil {
+		errlog.Fatal("unable to unpack to ", dst, ": ", err)
+	}
+
+	if path != dst {
+		log.Print("unpacked to ", path)
+	}
+}
+
+// isTTY attempts to determine whether the current stdout refers to a terminal.
+func isTTY() bool {
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		errlog.Println("Error getting Stat of os.Stdout:", err)
+		return true // Assume human readable
+	}
+	return (fi.Mode() & os.ModeNamedPipe) != os.ModeNamedPipe
+}
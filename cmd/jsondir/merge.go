@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mergeValue deep-merges src into dst and returns the result. Objects are merged recursively.
+// Arrays in src replace those in dst, unless concat is true, in which case they're appended to them.
+// Any other value in src replaces the one in dst. It's an error to merge an object with anything
+// else. key is the path of keys to dst, for errors. dst may be modified.
+func mergeValue(dst, src interface{}, concat bool, key []string) (interface{}, error) {
+	dobj, dok := dst.(map[string]interface{})
+	sobj, sok := src.(map[string]interface{})
+	switch {
+	case dok && sok:
+		for k, v := range sobj {
+			if prev, ok := dobj[k]; ok {
+				var err error
+				if v, err = mergeValue(prev, v, concat, append(key, k)); err != nil {
+					return nil, err
+				}
+			}
+			dobj[k] = v
+		}
+		return dobj, nil
+	case dok || sok:
+		return nil, fmt.Errorf("cannot merge %s with %s at %s", kindOf(src), kindOf(dst), keyPath(key))
+	}
+
+	if dary, ok := dst.([]interface{}); ok && concat {
+		if sary, ok := src.([]interface{}); ok {
+			return append(dary, sary...), nil
+		}
+	}
+	return src, nil
+}
+
+// kindOf returns the JSON kind of v for error messages.
+func kindOf(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case nil:
+		return "null"
+	}
+	return "a scalar"
+}
+
+// keyPath returns a readable form of a path of object keys.
+func keyPath(key []string) string {
+	if len(key) == 0 {
+		return "the root"
+	}
+	return fmt.Sprintf("%q", strings.Join(key, "."))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// yamlEncoder writes the interface{} trees produced by jsondir.Walk as YAML. It only understands
+// the types Walk can produce: nil, bool, int64, float64, json.Number, string, []interface{}, and
+// map[string]interface{}. Map keys are always emitted in sorted order.
+type yamlEncoder struct {
+	buf bytes.Buffer
+}
+
+// marshalYAML encodes v as a YAML document. If flow is true, the document is written in flow style
+// on a single line. Otherwise, it's written in block style. The result has no trailing newline.
+func marshalYAML(v interface{}, flow bool) ([]byte, error) {
+	var e yamlEncoder
+	var err error
+	if flow || isEmptyYAMLCollection(v) {
+		err = e.flow(v)
+	} else {
+		err = e.block(v, 0, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(e.buf.Bytes(), []byte("\n")), nil
+}
+
+func isEmptyYAMLCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *yamlEncoder) indent(n int) {
+	for ; n > 0; n-- {
+		e.buf.WriteByte(' ')
+	}
+}
+
+// block writes v in block style. If inline is true, the first line of v is written at the current
+// position (i.e., following a "- " sequence entry indicator) instead of being indented.
+func (e *yamlEncoder) block(v interface{}, depth int, inline bool) (err error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for i, k := range sortedKeys(v) {
+			if i > 0 || !inline {
+				e.indent(depth)
+			}
+			e.scalar(k)
+			e.buf.WriteByte(':')
+			if err = e.blockChild(v[k], depth+2, depth); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			if i > 0 || !inline {
+				e.indent(depth)
+			}
+			e.buf.WriteString("- ")
+			if isEmptyYAMLCollection(elem) {
+				err = e.flow(elem)
+				e.buf.WriteByte('\n')
+			} else {
+				err = e.block(elem, depth+2, true)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("yaml: unsupported block value of type %T", v)
+	}
+	return nil
+}
+
+// blockChild writes a mapping value following its key and colon. Non-empty maps are nested at
+// mapDepth and non-empty sequences at seqDepth.
+func (e *yamlEncoder) blockChild(v interface{}, mapDepth, seqDepth int) error {
+	if isEmptyYAMLCollection(v) {
+		e.buf.WriteByte(' ')
+		if err := e.flow(v); err != nil {
+			return err
+		}
+		e.buf.WriteByte('\n')
+		return nil
+	}
+
+	e.buf.WriteByte('\n')
+	if _, ok := v.([]interface{}); ok {
+		return e.block(v, seqDepth, false)
+	}
+	return e.block(v, mapDepth, false)
+}
+
+func (e *yamlEncoder) flow(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteString("null")
+	case bool:
+		e.buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		e.buf.WriteString(strconv.FormatInt(v, 10))
+	case json.Number:
+		e.buf.WriteString(v.String())
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			e.buf.WriteString(".nan")
+		case math.IsInf(v, 1):
+			e.buf.WriteString(".inf")
+		case math.IsInf(v, -1):
+			e.buf.WriteString("-.inf")
+		default:
+			e.buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case string:
+		e.scalar(v)
+	case []interface{}:
+		e.buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				e.buf.WriteString(", ")
+			}
+			if err := e.flow(elem); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+	case map[string]interface{}:
+		e.buf.WriteByte('{')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				e.buf.WriteString(", ")
+			}
+			e.scalar(k)
+			e.buf.WriteString(": ")
+			if err := e.flow(v[k]); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+	default:
+		return fmt.Errorf("yaml: unsupported value of type %T", v)
+	}
+	return nil
+}
+
+// scalar writes a string as a plain scalar if it's unambiguous, otherwise as a double-quoted
+// scalar. Go's quoting escapes are a subset of YAML's, so strconv.Quote is used for the latter.
+func (e *yamlEncoder) scalar(s string) {
+	if isPlainYAML(s) {
+		e.buf.WriteString(s)
+		return
+	}
+	e.buf.WriteString(strconv.Quote(s))
+}
+
+func isPlainYAML(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	switch strings.ToLower(s) {
+	case "y", "n", "yes", "no", "on", "off", "true", "false", "null", "~":
+		return false
+	}
+
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == '/':
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalYAMLDeterministic(t *testing.T) {
+	var v interface{}
+	doc := `{"z": 1, "a": {"y": [1, {"q": true, "b": null}], "c": "x"}, "m": {}, "k": [], "b": "two words"}`
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flow := range []bool{false, true} {
+		want, err := marshalYAML(v, flow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			got, err := marshalYAML(v, flow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("marshalYAML(flow = %t) = %s; want %s", flow, got, want)
+			}
+		}
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	cases := []struct {
+		name, in    string
+		block, flow string
+	}{
+		{
+			"nested",
+			`{"a":{"b":{"c":1}},"s":[1,[2,3],{"x":"y"}],"f":1.5,"t":true,"n":null}`,
+			"a:\n  b:\n    c: 1\nf: 1.5\n\"n\": null\ns:\n- 1\n- - 2\n  - 3\n- x: \"y\"\nt: true",
+			`{a: {b: {c: 1}}, f: 1.5, "n": null, s: [1, [2, 3], {x: "y"}], t: true}`,
+		},
+		{
+			"sequence of mappings",
+			`[{"a":1,"b":[]},{"c":{}}]`,
+			"- a: 1\n  b: []\n- c: {}",
+			`[{a: 1, b: []}, {c: {}}]`,
+		},
+		{"empty object", `{}`, "{}", "{}"},
+		{"empty array", `[]`, "[]", "[]"},
+		{"empty collections", `[[],{}]`, "- []\n- {}", "[[], {}]"},
+		{
+			"ambiguous scalars",
+			`["yes","Off","y","1","1e3","0x1F","","null","~","true"," lead","trail ","a: b","#c","-x","plain"]`,
+			"- \"yes\"\n- \"Off\"\n- \"y\"\n- \"1\"\n- \"1e3\"\n- \"0x1F\"\n- \"\"\n- \"null\"\n- \"~\"\n- \"true\"\n" +
+				"- \" lead\"\n- \"trail \"\n- \"a: b\"\n- \"#c\"\n- \"-x\"\n- plain",
+			`["yes", "Off", "y", "1", "1e3", "0x1F", "", "null", "~", "true", " lead", "trail ", "a: b", "#c", "-x", plain]`,
+		},
+		{"escapes", `["multi\nline","\t"]`, "- \"multi\\nline\"\n- \"\\t\"", `["multi\nline", "\t"]`},
+		{
+			"ambiguous keys",
+			`{"yes":1,"":2,"a: b":3,"1":4,"ok":5}`,
+			"\"\": 2\n\"1\": 4\n\"a: b\": 3\nok: 5\n\"yes\": 1",
+			`{"": 2, "1": 4, "a: b": 3, ok: 5, "yes": 1}`,
+		},
+		{"scalar root", `"yes"`, `"yes"`, `"yes"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(c.in), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			for flow, want := range map[bool]string{false: c.block, true: c.flow} {
+				got, err := marshalYAML(v, flow)
+				if err != nil {
+					t.Fatalf("marshalYAML(flow = %t) = %v", flow, err)
+				}
+				if string(got) != want {
+					t.Errorf("marshalYAML(flow = %t) =\n%s\nwant\n%s", flow, got, want)
+				}
+			}
+		})
+	}
+}
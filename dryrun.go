@@ -0,0 +1,94 @@
+package jsondir
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// dryRun writes a line describing the file at loc, in the directory parent, as kind to DryRun.
+// Lines are indented by depth, so that the lines of a walk form a tree.
+func (w *walker) dryRun(loc string, parent *dirFrame, kind string) {
+	name := loc
+	if parent != nil {
+		name = filepath.Base(loc)
+	}
+	fmt.Fprintf(w.DryRun, "%s%s -> %s\n", strings.Repeat("  ", parent.depthOf()), name, kind)
+}
+
+// dryRunFile describes the file at loc, named name, with the contents data to DryRun.
+func (w *walker) dryRunFile(loc string, parent *dirFrame, name string, data []byte) {
+	v, err := w.fileValue(name, data)
+	switch {
+	case err != nil:
+		w.dryRun(loc, parent, "invalid ("+err.Error()+")")
+	case strings.HasSuffix(name, "@") && rawFormat(name) == ".toml":
+		w.dryRun(loc, parent, valueKind(v)+" (raw TOML)")
+	case strings.HasSuffix(name, "@") && rawFormat(name) != "":
+		w.dryRun(loc, parent, valueKind(v)+" (raw YAML)")
+	case strings.HasSuffix(name, "@"):
+		w.dryRun(loc, parent, valueKind(v)+" (raw JSON)")
+	default:
+		w.dryRun(loc, parent, valueKind(v))
+	}
+}
+
+// hintKind returns the kind of value that a file named name is read as, if it's known from its
+// suffix. Otherwise, it returns the empty string.
+func hintKind(name string) string {
+	if strings.HasSuffix(name, "@") {
+		return ""
+	}
+
+	switch typeSuffix(name) {
+	case ".str":
+		return "string"
+	case ".int":
+		return "integer"
+	case ".hex":
+		return "hex"
+	case ".float":
+		return "float"
+	case ".bool":
+		return "boolean"
+	case ".null":
+		return "null"
+	case ".lines":
+		return "array (lines)"
+	case ".csv":
+		return "array (CSV)"
+	case ".b64":
+		return "string (base64)"
+	case ".env":
+		return "object (env)"
+	case ".time":
+		return "string (time)"
+	case ".dur":
+		return "duration"
+	}
+	return ""
+}
+
+// valueKind returns the kind of a value produced by a walk.
+func valueKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
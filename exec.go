@@ -0,0 +1,363 @@
+package jsondir
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type prefixWriter struct {
+	firstWrite bool
+	prefix     []byte
+	lb         byte
+	w          io.Writer
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		prefix: []byte("\n" + prefix),
+		w:      w,
+	}
+}
+
+func (p *prefixWriter) Write(b []byte) (n int, err error) {
+	if p.w == ioutil.Discard {
+		return len(b), nil
+	}
+
+	n = len(b)
+	if n == 0 {
+		return n, nil
+	}
+
+	if !p.firstWrite || p.lb == '\n' {
+		req := len(p.prefix) + len(b) - 1
+		buf := make([]byte, req)
+		copy(buf[copy(buf, p.prefix[1:]):], b)
+		b = buf
+		p.firstWrite = true
+	}
+
+	lb := b[len(b)-1]
+	numNLs := bytes.Count(b, p.prefix[:1])
+	if lb == '\n' {
+		numNLs--
+	}
+
+	if numNLs > 0 {
+		b = bytes.Replace(b, p.prefix[:1], p.prefix, numNLs)
+	}
+
+	wn, err := p.w.Write(b)
+	if wn > 0 {
+		p.lb = b[wn-1]
+	}
+
+	if err != nil {
+		return wn, err
+	}
+
+	if wn != len(b) {
+		return wn, io.ErrShortWrite
+	}
+
+	return n, err
+}
+
+// limitBuffer is a buffer that keeps at most limit bytes written to it, if limit is positive, and
+// silently discards the rest.
+type limitBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *limitBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit > 0 {
+		if room := b.limit - int64(b.Len()); room < int64(len(p)) {
+			if room < 0 {
+				room = 0
+			}
+			p = p[:room]
+		}
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// absPath returns the absolute path of loc, or loc itself if it can't be made absolute.
+func absPath(loc string) string {
+	path, err := filepath.Abs(loc)
+	if err != nil {
+		return loc
+	}
+	return path
+}
+
+// isExecutable returns whether the file fi is run to generate its value: whether it has an execute
+// bit set or an extension in ExecExts.
+func (w *walker) isExecutable(fi os.FileInfo) bool {
+	if fi.Mode()&0111 != 0 {
+		return true
+	}
+	_, ok := w.ExecExts[filepath.Ext(fi.Name())]
+	return ok
+}
+
+// interpreter returns the command and arguments that run the executable file at loc, from
+// ExecExts, or nil if it's run directly.
+func (w *walker) interpreter(loc string) []string {
+	return strings.Fields(w.ExecExts[filepath.Ext(loc)])
+}
+
+// execEnv returns the environment variables to run the executable file at loc, at the given depth,
+// with in addition to the inherited environment.
+func (w *walker) execEnv(fi os.FileInfo, loc string, depth int) []string {
+	env := []string{
+		"JSONDIR_PATH=" + absPath(loc),
+		"JSONDIR_ROOT=" + w.root,
+		"JSONDIR_KEY=" + w.entryKey(fi),
+		"JSONDIR_DEPTH=" + strconv.Itoa(depth),
+	}
+	return append(env, w.ExecEnv...)
+}
+
+// execArgs returns the arguments to run the executable file at loc with, if ExecArgs is set.
+func (w *walker) execArgs(fi os.FileInfo, loc string) []string {
+	if !w.ExecArgs {
+		return nil
+	}
+	return []string{absPath(loc), w.entryKey(fi), w.root}
+}
+
+// execStdin returns the standard input of the executable file at loc: its own contents if ExecStdin
+// is set, the contents of ExecStdinFile if that's set, or nil.
+func (w *walker) execStdin(loc string) ([]byte, error) {
+	switch {
+	case w.ExecStdinFile != "":
+		return ioutil.ReadFile(w.ExecStdinFile)
+	case w.ExecStdin:
+		return ioutil.ReadFile(loc)
+	}
+	return nil, nil
+}
+
+// execSkipCode returns the exit status of executables that are skipped: ExecSkipCode, or 65 if
+// it's zero.
+func (w *walker) execSkipCode() int {
+	if w.ExecSkipCode == 0 {
+		return 65
+	}
+	return w.ExecSkipCode
+}
+
+// errNoCache is returned by readProc, along with the output, for executables that exit with status
+// 66 when ExecCacheDir is set.
+var errNoCache = errors.New("output isn't cacheable")
+
+// execute runs the executable file at loc, at the given depth, and returns its output. If
+// ExecCacheDir is set, output is reused from it if possible.
+func (w *walker) execute(fi os.FileInfo, loc string, depth int) ([]byte, error) {
+	env, args := w.execEnv(fi, loc, depth), w.execArgs(fi, loc)
+	stdin, err := w.execStdin(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.ExecCacheDir == "" {
+		return w.readProc(loc, stdin, env, args...)
+	}
+
+	key, err := execCacheKey(fi, loc, stdin, env, append(w.interpreter(loc), args...))
+	if err != nil {
+		return nil, err
+	}
+
+	cached := filepath.Join(w.ExecCacheDir, key)
+	if out, err := ioutil.ReadFile(cached); err == nil {
+		w.log.Print("using cached output of ", loc)
+		return out, nil
+	}
+
+	out, err := w.readProc(loc, stdin, env, args...)
+	if err == errNoCache {
+		return out, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if w.MaxSize > 0 && int64(len(out)) > w.MaxSize {
+		// Output larger than MaxSize is cut short, so it's only correct for this MaxSize.
+		return out, nil
+	}
+
+	if err := writeCache(cached, out); err != nil {
+		w.errlog.Print("unable to cache output of ", loc, ": ", err)
+	}
+	return out, nil
+}
+
+// execCacheKey returns the name of the file in ExecCacheDir holding the output of the executable
+// file at loc when it's run with stdin, env, and args. It's a hash of the executable's contents,
+// size, and mtime, and of stdin, env, and args.
+func execCacheKey(fi os.FileInfo, loc string, stdin []byte, env, args []string) (string, error) {
+	data, err := ioutil.ReadFile(loc)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%d\x00", fi.Size(), fi.ModTime().UnixNano())
+	h.Write(data)
+	for _, s := range env {
+		io.WriteString(h, "\x00"+s)
+	}
+	for _, s := range args {
+		io.WriteString(h, "\x01"+s)
+	}
+	if stdin != nil {
+		fmt.Fprintf(h, "\x02%d\x00", len(stdin))
+		h.Write(stdin)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeCache writes out to the cache file at path. It's written to a temporary file first, so
+// that concurrent runs never read a partial file.
+func writeCache(path string, out []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(out)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// readProc runs the executable name, using its interpreter if it has one, and returns its output.
+// If stdin isn't nil, it's written to the executable's standard input. env is appended to the
+// inherited environment.
+func (w *walker) readProc(name string, stdin []byte, env []string, arg ...string) (out []byte, err error) {
+	ctx := w.ctx
+	if w.ExecTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.ExecTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, arg...)
+	if interp := w.interpreter(name); len(interp) > 0 {
+		arg = append(append(interp[1:], absPath(name)), arg...)
+		cmd = exec.CommandContext(ctx, interp[0], arg...)
+	}
+	setProcessGroup(cmd)
+	if !filepath.IsAbs(cmd.Path) {
+		cmd.Path, err = filepath.Abs(cmd.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create temporary directory for exec
+	if !w.NoTempExec {
+		dir, err := ioutil.TempDir("", "jsondir-exec")
+		if err != nil {
+			return nil, err
+		}
+		cmd.Dir = dir
+		defer func() {
+			if rmerr := os.RemoveAll(dir); rmerr != nil {
+				w.errlog.Print("unable to clean up temp directory ", dir, ": ", rmerr)
+			}
+		}()
+	} else if w.RelativeExec {
+		cmd.Dir = filepath.Dir(absPath(name))
+	}
+
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	stderr := newPrefixWriter(w.log.Writer(), name+": ")
+	cmd.Stderr = stderr
+	// Keep one byte past MaxSize so that the caller can tell whether output was too large.
+	stdout := &limitBuffer{}
+	if w.MaxSize > 0 {
+		stdout.limit = w.MaxSize + 1
+	}
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	out = stdout.Bytes()
+
+	if stderr.lb != '\n' && stderr.firstWrite {
+		_, err := io.WriteString(stderr.w, "\n")
+		if err != nil {
+			w.errlog.Print("unable to write newline to stderr (this will likely fail): ", err)
+		}
+	}
+
+	if err != nil && w.ctx.Err() != nil {
+		return nil, context.Canceled
+	} else if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %v", w.ExecTimeout)
+		if w.SkipExecTimeout {
+			w.errlog.Print("error executing ", name, ": ", err)
+			return nil, SkipFile(name + " (timed out)")
+		}
+		return nil, err
+	}
+
+	switch e := err.(type) {
+	case nil:
+		return out, nil
+	case *exec.ExitError:
+		switch ps := e.Sys().(type) {
+		case syscall.WaitStatus:
+			code := ps.ExitStatus()
+			if code != 0 {
+				w.log.Print(name, ": exited with status ", code)
+			}
+			switch {
+			case code == 0:
+				return out, nil
+			case code == w.execSkipCode():
+				return nil, w.strict(SkipFile(name))
+			case code == 66 && w.ExecCacheDir != "":
+				return out, errNoCache
+			default:
+				return nil, err
+			}
+		default:
+		}
+	default:
+		return nil, err
+	}
+
+	return out, err
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package jsondir
+
+import "os/exec"
+
+// setProcessGroup does nothing on systems without process groups. Only cmd itself is killed if its
+// context is done.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,93 @@
+package jsondir
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fileSystem is the filesystem a walk reads files from. Paths use the OS's separators.
+type fileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	Open(name string) (io.ReadCloser, error)
+	ReadLink(name string) (string, error)
+}
+
+// osFS is the OS's filesystem.
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]os.FileInfo, error) { return ioutil.ReadDir(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return ioutil.ReadFile(name) }
+func (osFS) Open(name string) (io.ReadCloser, error)    { return os.Open(name) }
+func (osFS) ReadLink(name string) (string, error)       { return os.Readlink(name) }
+
+// ioFS adapts an fs.FS. Unless the fs.FS has an Lstat method, as with fs.ReadLinkFS, it's treated
+// as having no symlinks.
+type ioFS struct {
+	fsys fs.FS
+}
+
+// lstatFS is an fs.FS that can describe symlinks instead of their targets.
+type lstatFS interface {
+	fs.FS
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// readLinkFS is an fs.FS that can read the targets of symlinks.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// name converts an OS path to an fs.FS path.
+func (f ioFS) name(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	if name = strings.TrimLeft(name, "/"); name == "" {
+		return "."
+	}
+	return name
+}
+
+func (f ioFS) Stat(name string) (os.FileInfo, error)   { return fs.Stat(f.fsys, f.name(name)) }
+func (f ioFS) ReadFile(name string) ([]byte, error)    { return fs.ReadFile(f.fsys, f.name(name)) }
+func (f ioFS) Open(name string) (io.ReadCloser, error) { return f.fsys.Open(f.name(name)) }
+
+func (f ioFS) Lstat(name string) (os.FileInfo, error) {
+	if lfs, ok := f.fsys.(lstatFS); ok {
+		return lfs.Lstat(f.name(name))
+	}
+	return f.Stat(name)
+}
+
+func (f ioFS) ReadLink(name string) (string, error) {
+	if rfs, ok := f.fsys.(readLinkFS); ok {
+		return rfs.ReadLink(f.name(name))
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+func (f ioFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(f.fsys, f.name(name))
+	if err != nil {
+		return nil, err
+	}
+
+	info := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		info = append(info, fi)
+	}
+	return info, nil
+}
@@ -0,0 +1,196 @@
+package jsondir
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is an ignore pattern from Options.IgnorePatterns or an ignore file.
+type ignoreRule struct {
+	pattern string
+	base    string // The directory containing the ignore file, if any
+	negate  bool   // Re-include files matching the pattern
+	dirOnly bool   // Only match directories
+
+	// anchored causes a pattern without a path separator to match only files in base, rather
+	// than files with that basename at any depth, as with a leading '/' in an ignore file.
+	anchored bool
+}
+
+// parseIgnoreRule parses an ignore pattern. A '!' prefix negates the pattern and a trailing path
+// separator limits it to directories.
+func parseIgnoreRule(pattern, base string) ignoreRule {
+	rule := ignoreRule{pattern: pattern, base: base}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate, rule.pattern = true, pattern[1:]
+	}
+	if trimmed := strings.TrimRight(rule.pattern, "/"+string(os.PathSeparator)); trimmed != rule.pattern && trimmed != "" {
+		rule.dirOnly, rule.pattern = true, trimmed
+	}
+	return rule
+}
+
+// match returns whether the rule's pattern matches path, a file in the walk of root. isDir is
+// whether path is a directory, for rules that only match directories. A pattern without a path
+// separator, unless it's anchored, is matched against the basename of path. Otherwise, it's matched
+// against path relative to the directory of the ignore file it came from. If it didn't come from
+// an ignore file, it's matched against both path itself and path relative to root.
+func (r ignoreRule) match(path, root string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if !r.anchored && strings.IndexByte(r.pattern, os.PathSeparator) == -1 {
+		return matchGlob(r.pattern, filepath.Base(path))
+	}
+
+	if r.base == "" && matchGlob(r.pattern, path) {
+		return true
+	}
+
+	base := r.base
+	if base == "" {
+		base = root
+	}
+
+	rel, err := filepath.Rel(base, path)
+	return err == nil && matchGlob(r.pattern, rel)
+}
+
+// matchGlob returns whether name matches pattern. Patterns follow filepath.Match rules, except that
+// a "**" path element matches zero or more path elements.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "**") {
+		m, _ := filepath.Match(pattern, name)
+		return m
+	}
+
+	sep := string(os.PathSeparator)
+	return matchElems(strings.Split(pattern, sep), strings.Split(name, sep))
+}
+
+func matchElems(pattern, elems []string) bool {
+	for ; len(pattern) > 0; pattern, elems = pattern[1:], elems[1:] {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+
+		if m, _ := filepath.Match(pattern[0], elems[0]); !m {
+			return false
+		}
+	}
+	return len(elems) == 0
+}
+
+// ignoreFile returns whether the file at path, in the directory dir, should be ignored. isDir is
+// whether path is a directory. dir may be nil to only consider IgnorePatterns.
+func (w *walker) ignoreFile(path string, isDir bool, dir *dirFrame) bool {
+	ignored := w.applyIgnoreRules(false, w.ignores, path, isDir)
+	if dir != nil {
+		ignored = w.applyIgnoreRules(ignored, dir.ignores, path, isDir)
+	}
+	return ignored
+}
+
+// isDir returns whether the file at path, described by fi, is a directory or a followed symlink to
+// one.
+func (w *walker) isDir(path string, fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeSymlink != 0 && w.FollowSymlinks {
+		target, err := w.fs.Stat(path)
+		return err == nil && target.IsDir()
+	}
+	return fi.IsDir()
+}
+
+// includeFile returns whether the file at path matches IncludePatterns, if there are any, or is in
+// a directory matching one that only matches directories. Directories are always included so that
+// the files in them can be.
+func (w *walker) includeFile(path string, isDir bool) bool {
+	if len(w.includes) == 0 || isDir {
+		return true
+	}
+
+	for _, r := range w.includes {
+		if r.match(path, w.root, false) {
+			return true
+		}
+		if !r.dirOnly {
+			continue
+		}
+		root := filepath.Clean(w.root)
+		for dir := filepath.Dir(path); dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if r.match(dir, w.root, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyIgnoreRules applies rules to path in order, so that the last matching rule decides whether
+// it's ignored. If no rule matches, ignored is returned.
+func (w *walker) applyIgnoreRules(ignored bool, rules []ignoreRule, path string, isDir bool) bool {
+	for _, r := range rules {
+		if r.negate == ignored && r.match(path, w.root, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// readIgnoreFiles returns the ignore rules for the directory loc: those of its parent followed by
+// any rules from the IgnoreFiles in loc.
+func (w *walker) readIgnoreFiles(loc string, parent *dirFrame) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	if parent != nil {
+		// Limit capacity so that appending never writes to the parent's rules.
+		rules = parent.ignores[:len(parent.ignores):len(parent.ignores)]
+	}
+
+	for _, name := range w.IgnoreFiles {
+		file := filepath.Join(loc, name)
+		f, err := w.fs.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), " \t\r")
+			if line == "" || line[0] == '#' {
+				continue
+			}
+
+			rule := parseIgnoreRule(line, loc)
+			rule.anchored = strings.HasPrefix(rule.pattern, "/")
+			rule.pattern = filepath.FromSlash(strings.TrimPrefix(rule.pattern, "/"))
+
+			if _, err := filepath.Match(rule.pattern, "."); err != nil {
+				w.errlog.Printf("ignoring invalid pattern %q in %s: %v", line, file, err)
+				continue
+			}
+			rules = append(rules, rule)
+		}
+
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,129 @@
+package jsondir
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreFiles(t *testing.T) {
+	cases := []struct {
+		name   string
+		ignore string
+		want   string
+	}{
+		{"basename", "build", `{"a":{"log.log":5,"y.tmp":3},"keep":"k","out.log":6,"z.tmp":4}`},
+		{"glob", "*.log", `{"a":{"build":{"x":2},"y.tmp":3},"build":{"x":1},"keep":"k","z.tmp":4}`},
+		{"unanchored", "build\n*.log\n*.tmp\n", `{"a":{},"keep":"k"}`},
+		{"anchored", "/build\n", `{"a":{"build":{"x":2},"log.log":5,"y.tmp":3},"keep":"k","out.log":6,"z.tmp":4}`},
+		{"anchored dir only", "/build/\n/keep/\n", `{"a":{"build":{"x":2},"log.log":5,"y.tmp":3},"keep":"k","out.log":6,"z.tmp":4}`},
+		{"path", "a/build", `{"a":{"log.log":5,"y.tmp":3},"build":{"x":1},"keep":"k","out.log":6,"z.tmp":4}`},
+		{"negate", "*.tmp\n!z.tmp", `{"a":{"build":{"x":2},"log.log":5},"build":{"x":1},"keep":"k","out.log":6,"z.tmp":4}`},
+		{"double star", "**/build/x", `{"a":{"build":{},"log.log":5,"y.tmp":3},"build":{},"keep":"k","out.log":6,"z.tmp":4}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			root := writeTree(t, map[string]string{
+				".jsondirignore": c.ignore,
+				"build/x":        "1",
+				"a/build/x":      "2",
+				"a/y.tmp":        "3",
+				"a/log.log":      "5",
+				"z.tmp":          "4",
+				"out.log":        "6",
+				"keep":           "k",
+			})
+			opts := Options{IgnorePatterns: []string{".*"}, IgnoreFiles: []string{".jsondirignore"}}
+			if got := walkJSON(t, root, opts); got != c.want {
+				t.Errorf("Walk() = %s; want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreFilesNested(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":       "*.tmp\n",
+		"a/.gitignore":     "/build\n!keep.tmp\n",
+		"a/build/x":        "1",
+		"a/b/build/x":      "2",
+		"a/keep.tmp":       "3",
+		"a/drop.tmp":       "4",
+		"a/b/keep.tmp":     "5",
+		"b/build/x":        "6",
+		"b/keep.tmp":       "7",
+		"b/.gitignore":     "!*.tmp\n/*.tmp\n",
+		"b/c/sub.tmp":      "8",
+		"c/.jsondirignore": "/x\n",
+		"c/x":              "9",
+		"c/d/x":            "10",
+	})
+	opts := Options{IgnorePatterns: []string{".*"}, IgnoreFiles: []string{".jsondirignore", ".gitignore"}}
+	want := `{"a":{"b":{"build":{"x":2},"keep.tmp":5},"keep.tmp":3},"b":{"build":{"x":6},"c":{"sub.tmp":8}},"c":{"d":{"x":10}}}`
+	if got := walkJSON(t, root, opts); got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+}
+
+func TestIncludePatterns(t *testing.T) {
+	cases := []struct {
+		name     string
+		includes []string
+		want     string
+	}{
+		{"glob", []string{"*.json"}, `{"a.json":1,"config":{"c.json":3}}`},
+		{"dir only", []string{"config/"}, `{"config":{"b":2,"c.json":3,"sub":{"d":4}}}`},
+		{"dir only path", []string{"config/sub/"}, `{"config":{"sub":{"d":4}}}`},
+		{"path", []string{"config/*"}, `{"config":{"b":2,"c.json":3}}`},
+		{"several", []string{"x", "config/sub/"}, `{"config":{"sub":{"d":4}},"x":5}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			root := writeTree(t, map[string]string{
+				"a.json":        "1",
+				"config/b":      "2",
+				"config/c.json": "3",
+				"config/sub/d":  "4",
+				"x":             "5",
+			})
+			if got := walkJSON(t, root, Options{IncludePatterns: c.includes}); got != c.want {
+				t.Errorf("Walk() = %s; want %s", got, c.want)
+			}
+		})
+	}
+
+	if _, err := Walk(".", Options{IncludePatterns: []string{"!x"}}); err == nil {
+		t.Error("Walk() with IncludePatterns = [!x] = nil; want an error")
+	}
+}
+
+func TestIgnoreRuleMatch(t *testing.T) {
+	root := filepath.FromSlash("/r")
+	cases := []struct {
+		rule  ignoreRule
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{parseIgnoreRule("*.tmp", ""), "/r/a/b.tmp", false, true},
+		{parseIgnoreRule("a/*.tmp", ""), "/r/a/b.tmp", false, true},
+		{parseIgnoreRule("a/*.tmp", ""), "/r/c/a/b.tmp", false, false},
+		{parseIgnoreRule("dir/", ""), "/r/dir", false, false},
+		{parseIgnoreRule("dir/", ""), "/r/dir", true, true},
+		{parseIgnoreRule("**/x", ""), "/r/a/b/x", false, true},
+		{parseIgnoreRule("x", "/r/a"), "/r/a/b/x", false, true},
+		{ignoreRule{pattern: "x", base: "/r/a", anchored: true}, "/r/a/x", false, true},
+		{ignoreRule{pattern: "x", base: "/r/a", anchored: true}, "/r/a/b/x", false, false},
+		{ignoreRule{pattern: "x", base: "/r/a", anchored: true}, "/r/x", false, false},
+	}
+
+	for _, c := range cases {
+		path := filepath.FromSlash(c.path)
+		c.rule.pattern = filepath.FromSlash(c.rule.pattern)
+		c.rule.base = filepath.FromSlash(c.rule.base)
+		if got := c.rule.match(path, root, c.isDir); got != c.want {
+			t.Errorf("%+v.match(%q) = %t; want %t", c.rule, c.path, got, c.want)
+		}
+	}
+}
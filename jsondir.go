@@ -0,0 +1,565 @@
+// Package jsondir converts directory structures and their contents to JSON-compatible values.
+//
+// Walk converts a file or directory tree to a value made up of nil, bool, int64, float64, string,
+// []interface{}, and map[string]interface{} values (and json.Number, if Options.UseNumber is set).
+// Boolean values are true/TRUE and false/FALSE, numerics are any normal value handled by
+// strconv.ParseInt, floats any string convertible by strconv.ParseFloat, the string "null" or
+// "NULL" is a null value, and everything else is treated as a string. Numbers with a leading zero,
+// such as "0123" or "0x1F", are strings unless Options.AutoBase is set.
+//
+// Files ending in an '@' (at sign) are treated as raw JSON values and will be unmarshaled upon
+// loading to verify they're valid. Invalid data is a failure. Files ending in ".yaml@" or ".yml@"
+// are decoded as YAML, and files ending in ".toml@" as TOML, instead, and that suffix is trimmed
+// from their key. Only common subsets of YAML and TOML are supported: YAML anchors, aliases, tags,
+// and multiple documents are a failure.
+//
+// Files ending in a type hint suffix (.str, .int, .float, .bool, or .null) are always converted to
+// that type, and it's a failure if their contents aren't valid for it. The suffix is trimmed from
+// the file's key. A type hint followed by an '@' is part of the key of a raw JSON file. Files
+// ending in .lines are arrays of each of their lines, converted like the contents of any other file.
+// Files ending in .hex are hexadecimal integers, with or without a "0x" prefix, regardless of
+// Options.IntBase and Options.AutoBase. Files ending in .time are times, normalized to RFC 3339 in
+// UTC. Files ending in .dur are durations, normalized according to Options.DurationUnit. Files
+// ending in .csv are arrays of objects, one for each record after the first, which holds their
+// keys. Malformed CSV is a failure. Files ending in .env are objects of the KEY=VALUE lines of a
+// dotenv file, with their values converted like the contents of any other file unless they're
+// quoted. Files ending in .b64 are strings holding the base64 encoding of their contents, for
+// binary files. Conversely, files ending in ".b64@" hold base64, which is decoded and read as the
+// contents of a file named without that suffix. Invalid base64 is a failure.
+//
+// Directories ending in "[]" are converted to arrays and all other directories to objects. A
+// directory ending in "{}" is always an object. Either suffix is trimmed from its key. Array
+// elements are ordered by file name, or numerically if every file name is an integer. With
+// Options.DefaultArray, all directories not ending in "{}" are arrays instead. A directory
+// ending in "!" must contain exactly one file, whose value it takes, and the '!' is also trimmed.
+//
+// If Options.AllowExecute is set, executable files will be run to generate their values.
+package jsondir
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options controls how Walk converts files and directories.
+type Options struct {
+	// FollowSymlinks causes symlinks to be followed. By default, symlinks are skipped. Symlinks to
+	// a directory containing them, or that loop back to themselves, are skipped to avoid cycles.
+	FollowSymlinks bool
+	// FollowFileSymlinks causes symlinks to files to be followed, while symlinks to directories
+	// are still skipped. It has no effect if FollowSymlinks is set.
+	FollowFileSymlinks bool
+	// SymlinkMeta causes symlinks that aren't followed to be represented by an object holding
+	// their target, as read, in "$symlink", and in "$type" whether it's a "file", "dir",
+	// "missing", or "other", instead of being skipped.
+	SymlinkMeta bool
+	// KeepWhitespace keeps trailing whitespace in strings read from files.
+	KeepWhitespace bool
+	// TrimSpace trims leading whitespace, as well as trailing whitespace, from files. Types are
+	// inferred from the trimmed contents even if KeepWhitespace is set, but KeepWhitespace still
+	// keeps all whitespace in strings.
+	TrimSpace bool
+	// NormalizeNewlines converts CRLF line endings to LF in files, other than raw JSON and .b64
+	// files, before they're trimmed and converted.
+	NormalizeNewlines bool
+	// RawStrings disables type inference, so that files are always read as strings. Raw JSON
+	// files and files with type hint suffixes are unaffected.
+	RawStrings bool
+	// NullTokens, TrueTokens, and FalseTokens are the contents of files that are read as null,
+	// true, and false. If nil, DefaultNullTokens, DefaultTrueTokens, and DefaultFalseTokens are
+	// used. Tokens are case-sensitive and are checked in that order.
+	NullTokens  []string
+	TrueTokens  []string
+	FalseTokens []string
+	// ParseTime causes files containing a time in one of TimeLayouts, that aren't a number, to be
+	// read as a string holding the time in RFC 3339 format in UTC.
+	ParseTime bool
+	// TimeLayouts are the time.Parse layouts of times read from files with ParseTime or a .time
+	// suffix, tried in order. If empty, DefaultTimeLayouts is used. Times without a time zone are
+	// in UTC.
+	TimeLayouts []string
+	// DurationUnit is the unit of durations read from .dur files, which are integers counting it,
+	// truncated toward zero. If zero, they're strings as formatted by time.Duration, such as
+	// "1h30m0s".
+	DurationUnit time.Duration
+	// Empty controls how empty files are represented. Unless KeepWhitespace is set, files
+	// containing only whitespace are empty. Raw JSON files and files with a type hint suffix are
+	// unaffected.
+	Empty EmptyMode
+	// Binary controls how files whose contents aren't valid UTF-8 text are represented. Raw JSON
+	// files and files with a type hint suffix are unaffected.
+	Binary BinaryMode
+	// AutoBase allows integers to have a leading zero, which is parsed by strconv.ParseInt as a
+	// base prefix (e.g., "010" is 8 and "0x1F" is 31). By default, numbers with a leading zero are
+	// read as strings so that things like zip codes survive.
+	AutoBase bool
+	// IntBase is the base of integers, from 2 to 36, such as 10 to read "0755" as 755 and "0x1F" as
+	// a string. Leading zeros are allowed, and base prefixes and digits outside the base aren't. If
+	// zero, integers are read in the base given by their prefix, as with AutoBase.
+	IntBase int
+	// HexStrings causes .hex files to be read as strings holding their contents as written, once
+	// they're checked to be valid hexadecimal integers, instead of as an int64. With AutoBase,
+	// integers with a "0x" prefix in other files are also read as they're written, such as "0xFF"
+	// instead of 255.
+	HexStrings bool
+	// NumUnderscore allows numbers to have single underscores between their digits, as in
+	// "1_000" or "1_000.5", following Go's number literal syntax. Integers read in IntBase may have
+	// them between any two digits in that base. Without NumUnderscore, contents with underscores
+	// aren't numbers, and .int and .float files containing them are a failure.
+	NumUnderscore bool
+	// CSVDelimiter is the field delimiter of .csv files. If zero, it's a comma.
+	CSVDelimiter rune
+	// Gzip causes files ending in ".gz" to be decompressed and read as though they didn't end in
+	// it, so that "payload.json@.gz" is raw JSON with the key "payload.json". Corrupt gzip data is
+	// a failure. MaxSize limits the decompressed contents as well as the file itself, but a file
+	// larger than MaxSize is never truncated before it's decompressed.
+	Gzip bool
+	// MaxSize is the size in bytes of the largest file to read, or of the largest output of an
+	// executable. Larger files are handled according to Oversize without being read, and output
+	// past MaxSize is discarded. If zero, there is no limit.
+	MaxSize int64
+	// Oversize controls what happens to files larger than MaxSize.
+	Oversize OversizeMode
+	// Strict makes files that would otherwise be skipped a failure: symlinks that aren't followed
+	// or that form a cycle, files whose names are empty once their suffixes are trimmed, files
+	// larger than MaxSize (with OversizeSkip), and executables that exit with ExecSkipCode. It also
+	// makes files with the same key in an object, such as "port" and "port@", a failure, regardless
+	// of Duplicates. Files skipped because of IgnorePatterns, IncludePatterns, IgnoreFiles,
+	// MaxDepth, or SkipExecTimeout are still skipped.
+	Strict bool
+	// Duplicates controls which file is used when files in a directory have the same key once
+	// their suffixes are trimmed, such as "port" and "port@" or "hosts[]" and "hosts". Unless it's
+	// DuplicateError, an error is logged.
+	Duplicates DuplicateMode
+	// UseNumber causes files containing a valid JSON number to be read as a json.Number instead of
+	// an int64 or float64, preserving its precision and formatting. Numbers in raw JSON files are
+	// also decoded as json.Number.
+	UseNumber bool
+
+	// AllowExecute causes executable files to be run to produce their values.
+	AllowExecute bool
+	// NoTempExec runs executables from the working directory instead of a temporary directory.
+	NoTempExec bool
+	// RelativeExec runs executables from their own directory. It implies NoTempExec.
+	RelativeExec bool
+	// ExecExts maps file extensions, such as ".sh", to the command that runs files with them as
+	// executables, regardless of their mode. The command is split into fields and given the file's
+	// path as its last argument. If the command is empty, the file is run directly.
+	ExecExts map[string]string
+	// ExecJSON causes the output of every executable to be read as raw JSON, as though its name
+	// ended in an '@'. Output that isn't valid JSON is a failure.
+	ExecJSON bool
+	// ExecEnv is a list of KEY=VALUE environment variables to set for executables, in addition
+	// to their inherited environment and the following variables:
+	//
+	//	JSONDIR_PATH	The absolute path of the executable.
+	//	JSONDIR_ROOT	The path given to Walk.
+	//	JSONDIR_KEY	The executable's key, as it would be in an object.
+	//	JSONDIR_DEPTH	The executable's depth, where root is at depth 0 and its entries at 1.
+	ExecEnv []string
+	// ExecArgs causes executables to be run with the same path, root, and key as in their
+	// environment, as arguments in that order.
+	ExecArgs bool
+	// ExecStdin causes executables to be given their own contents on standard input.
+	ExecStdin bool
+	// ExecStdinFile is the path of a file whose contents are given to executables on standard
+	// input instead of their own contents. It takes precedence over ExecStdin.
+	ExecStdinFile string
+	// ExecTimeout is how long an executable may run before it's killed, along with any processes
+	// in its process group, and its file fails. If zero, there is no timeout.
+	ExecTimeout time.Duration
+	// ExecCacheDir is a directory to cache the output of executables in. If set, an executable
+	// isn't run if its output is cached for its current contents, size, mtime, environment,
+	// arguments, and standard input. Executables whose output shouldn't be cached can exit with
+	// status 66, which is otherwise a failure.
+	ExecCacheDir string
+	// ExecSkipCode is the exit status of executables that are skipped instead of failing. If zero,
+	// it's 65. It takes precedence over status 66 with ExecCacheDir.
+	ExecSkipCode int
+	// SkipExecTimeout causes executables that time out to be skipped instead of failing.
+	SkipExecTimeout bool
+
+	// EmptyDir controls how directories with nothing in them, once files are ignored or
+	// skipped, are represented.
+	EmptyDir EmptyDirMode
+
+	// RawKeys causes object keys to be the names of their files, keeping suffixes such as "@",
+	// ".int", "[]", and "{}", which still control how files are converted.
+	RawKeys bool
+	// KeyCase converts the keys of files, once their suffixes are trimmed, to another case, such
+	// as from "max-retries" to "maxRetries". Each part of a key between dots is converted on its
+	// own. Keys from RawKeys and KeyMap, and keys in the values of raw JSON files, are unchanged.
+	KeyCase KeyCaseMode
+	// DefaultArray makes directories arrays unless their names end in "{}" (or '!'), as though
+	// they all ended in "[]".
+	DefaultArray bool
+	// StripExt trims the extension from the keys of files, once their other suffixes are trimmed,
+	// so that "timeout.json" has the key "timeout". Names that are only an extension, such as
+	// ".json", are kept. StripExts trims only the extensions it lists, such as ".json".
+	StripExt  bool
+	StripExts []string
+	// KeyMap is a list of PATTERN=KEY rules that replace the keys of files whose names match
+	// PATTERN, a filepath.Match pattern, with KEY. The first matching rule is used, after any
+	// suffixes and extensions are trimmed, so "My File=my_file" gives "My File" the key "my_file".
+	KeyMap []string
+	// DotKeys nests the values of files whose keys contain a '.' in objects, so that "db.host" is
+	// the key "host" in an object at "db". It's merged with any other object at "db", such as from
+	// a directory, and it's a failure if there's a value at "db" that isn't an object. A literal
+	// '.' in a key can be escaped as "\.".
+	DotKeys bool
+	// Meta causes each file's value to be wrapped in an object with its "value" and its file
+	// metadata: its "mode" as an octal string (e.g., "0644"), its "size" in bytes, and its "mtime"
+	// as an RFC 3339 timestamp in UTC. Objects get the metadata of their directory as a "_meta" key,
+	// unless they already have one. Arrays are unchanged.
+	Meta bool
+
+	// NaturalSort orders the elements of arrays whose names aren't all integers naturally, so
+	// that runs of digits are compared by their integer value (e.g., "item2" comes before
+	// "item10"). Otherwise, they're ordered lexically.
+	NaturalSort bool
+
+	// Jobs is the maximum number of directory entries walked concurrently. If less than 2,
+	// entries are walked one at a time. Regardless of Jobs, array elements are always in the
+	// order of their file names.
+	Jobs int
+
+	// MaxDepth is the maximum number of directory levels to walk, including root. Directories
+	// beyond it are handled according to BeyondDepth. If MaxDepth is zero or negative, there is
+	// no limit.
+	MaxDepth int
+	// BeyondDepth controls how directories beyond MaxDepth are represented.
+	BeyondDepth DepthMode
+
+	// IgnorePatterns is a list of filepath.Match patterns for files to skip. If a pattern does
+	// not contain a path separator, it's only matched against a file's basename. Otherwise, it
+	// matches a file if it matches either the file's path as walked (i.e., including root) or its
+	// path relative to root. A "**" path element in a pattern matches zero or more path
+	// elements, as in "**/node_modules" or "src/**/*.tmp". A pattern prefixed with '!'
+	// re-includes files matched by an earlier pattern, and a pattern ending in a path separator
+	// only matches directories. Patterns are applied in order, so the last matching pattern
+	// decides whether a file is ignored. Unlike the jsondir command, there are no default ignore
+	// patterns.
+	IgnorePatterns []string
+	// IncludePatterns is a list of patterns, following the same rules as IgnorePatterns (but
+	// without '!', which is an error), for the files to walk. If there are any, only files matching
+	// at least one of them are walked, and IgnorePatterns can still exclude those. A pattern ending
+	// in a path separator includes every file in the directories it matches. Directories are walked
+	// regardless, but are omitted if nothing in them is included.
+	IncludePatterns []string
+	// IgnoreFiles is a list of file names to read additional ignore patterns from in each
+	// directory walked, such as ".gitignore". Each line of an ignore file is a pattern like those
+	// of IgnorePatterns, applied to that directory and its subdirectories. Patterns with a path
+	// separator are matched against paths relative to the ignore file's directory, so a leading
+	// '/', as in "/build", anchors a pattern to that directory. Blank lines and lines beginning
+	// with '#' are skipped. Patterns are applied in order after IgnorePatterns, from the root of
+	// the walk down.
+	IgnoreFiles []string
+
+	// KeepGoing causes files that fail to be left out of their directory instead of stopping the
+	// walk. Walk then returns the errors of every file that failed, along with the value of the
+	// rest.
+	KeepGoing bool
+
+	// DryRun, if set, causes Walk to write a description of how each file and directory would be
+	// converted to it instead of converting them, and Walk returns the structure of the result
+	// with null in place of every file's value. Each line is a file's name and its kind, such as
+	// "port -> integer", indented by its depth. Files whose kind is known from their suffix aren't
+	// read, and executables aren't run. Entries are walked one at a time, regardless of Jobs.
+	DryRun io.Writer
+
+	// Manifest, if not nil, is filled with the JSON Pointer (RFC 6901) of each value in the result
+	// of Walk that came from a file or directory, mapped to the absolute path of that file or
+	// directory (or its path in fsys, for WalkFS). The root's pointer is the empty string. Values
+	// inside raw JSON files and the output of executables map to the file itself.
+	Manifest map[string]string
+
+	// Log receives verbose log messages and the stderr of executed files. If nil, these are
+	// discarded.
+	Log *log.Logger
+	// ErrorLog receives error messages. If nil, these are discarded.
+	ErrorLog *log.Logger
+}
+
+// DepthMode controls how directories beyond Options.MaxDepth are represented.
+type DepthMode int
+
+const (
+	// DepthOmit skips directories beyond the maximum depth.
+	DepthOmit DepthMode = iota
+	// DepthNull represents directories beyond the maximum depth as null.
+	DepthNull
+	// DepthEmpty represents directories beyond the maximum depth as an empty object or array.
+	DepthEmpty
+)
+
+// Errors is returned by Walk when Options.KeepGoing is set and any files failed. It holds the error
+// of each file that failed, in order of their paths.
+type Errors []*fs.PathError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// EmptyMode controls how empty files are represented.
+type EmptyMode int
+
+const (
+	// EmptyString represents empty files as an empty string.
+	EmptyString EmptyMode = iota
+	// EmptyNull represents empty files as null.
+	EmptyNull
+	// EmptySkip skips empty files.
+	EmptySkip
+)
+
+// OversizeMode controls what happens to files larger than Options.MaxSize.
+type OversizeMode int
+
+const (
+	// OversizeSkip skips files larger than MaxSize.
+	OversizeSkip OversizeMode = iota
+	// OversizeError makes files larger than MaxSize a failure.
+	OversizeError
+	// OversizeTruncate reads only the first MaxSize bytes of files larger than MaxSize.
+	OversizeTruncate
+)
+
+// KeyCaseMode controls the case of keys. Keys are split into words at each '-', '_', or space, and
+// at each change from lowercase to uppercase, as in "maxRetries".
+type KeyCaseMode int
+
+const (
+	// KeyCaseKeep keeps keys as they are.
+	KeyCaseKeep KeyCaseMode = iota
+	// KeyCaseCamel converts keys to camelCase.
+	KeyCaseCamel
+	// KeyCaseSnake converts keys to snake_case.
+	KeyCaseSnake
+	// KeyCaseKebab converts keys to kebab-case.
+	KeyCaseKebab
+	// KeyCaseLower converts keys to lowercase, without splitting them into words.
+	KeyCaseLower
+	// KeyCaseUpper converts keys to uppercase, without splitting them into words.
+	KeyCaseUpper
+)
+
+// DuplicateMode controls which of the files with the same key in an object is used.
+type DuplicateMode int
+
+const (
+	// DuplicateLast uses the file whose name sorts last.
+	DuplicateLast DuplicateMode = iota
+	// DuplicateFirst uses the file whose name sorts first.
+	DuplicateFirst
+	// DuplicateError makes files with the same key a failure.
+	DuplicateError
+)
+
+// BinaryMode controls how binary files are represented. A file is binary if its contents aren't
+// valid UTF-8 or contain a NUL byte.
+type BinaryMode int
+
+const (
+	// BinaryString represents binary files as strings, replacing invalid UTF-8 when encoded.
+	BinaryString BinaryMode = iota
+	// BinaryBase64 represents binary files as base64-encoded strings, as if they ended in .b64.
+	BinaryBase64
+	// BinarySkip skips binary files.
+	BinarySkip
+	// BinaryError makes binary files a failure.
+	BinaryError
+)
+
+// EmptyDirMode controls how empty directories are represented.
+type EmptyDirMode int
+
+const (
+	// EmptyDirKeep represents empty directories as an empty object, or null if they're arrays.
+	EmptyDirKeep EmptyDirMode = iota
+	// EmptyDirObject represents empty directories as an empty object, even if they're arrays.
+	EmptyDirObject
+	// EmptyDirArray represents empty directories as an empty array, even if they're objects.
+	EmptyDirArray
+	// EmptyDirNull represents empty directories as null.
+	EmptyDirNull
+	// EmptyDirSkip skips empty directories.
+	EmptyDirSkip
+)
+
+// SkipFile errors are returned by walk functions when a file is to be skipped. This can occur if
+// the file is ignored, a symlink (when symlinks are ignored), or if the file was both executable
+// and exited with Options.ExecSkipCode (65 by default). Any other non-zero status is a failure.
+type SkipFile string
+
+func (s SkipFile) Error() string {
+	return "skipping file entry " + string(s)
+}
+
+// IsSkip returns whether err is a SkipFile error.
+func IsSkip(err error) bool {
+	_, ok := err.(SkipFile)
+	return ok
+}
+
+// Walk converts the file or directory at root to a JSON-compatible value. If root itself is
+// skipped, Walk returns a SkipFile error. If Options.KeepGoing is set and any files failed, Walk
+// returns the value of the rest of them along with an Errors.
+func Walk(root string, opts Options) (interface{}, error) {
+	return WalkContext(context.Background(), root, opts)
+}
+
+// WalkContext is like Walk, but stops walking and kills any running executables if ctx is done
+// first, in which case it returns ctx.Err().
+func WalkContext(ctx context.Context, root string, opts Options) (interface{}, error) {
+	return walk(ctx, osFS{}, root, opts)
+}
+
+// WalkFS is like Walk, but converts the file or directory at root in fsys, such as an os.DirFS or
+// fstest.MapFS. The root of fsys is ".". Since the files of fsys can't be run, Options.AllowExecute
+// has no effect. Symlinks are only detected if fsys has an Lstat method, as with fs.ReadLinkFS;
+// otherwise, fsys is assumed to have none.
+func WalkFS(fsys fs.FS, root string, opts Options) (interface{}, error) {
+	return WalkFSContext(context.Background(), fsys, root, opts)
+}
+
+// WalkFSContext is like WalkFS, but stops walking if ctx is done first, in which case it returns
+// ctx.Err().
+func WalkFSContext(ctx context.Context, fsys fs.FS, root string, opts Options) (interface{}, error) {
+	return walk(ctx, ioFS{fsys}, root, opts)
+}
+
+func walk(ctx context.Context, fsys fileSystem, root string, opts Options) (interface{}, error) {
+	w, err := newWalker(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer w.cancel()
+	w.fs = fsys
+	w.root = root
+
+	v, err := w.walkValue(nil, root, nil)
+	if w.Manifest != nil && (err == nil || len(w.errs) > 0) {
+		w.fillManifest()
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err == nil && len(w.errs) > 0:
+		sort.Slice(w.errs, func(i, j int) bool { return w.errs[i].Path < w.errs[j].Path })
+		return v, w.errs
+	}
+	return v, err
+}
+
+type walker struct {
+	Options
+	log    *log.Logger
+	errlog *log.Logger
+	fs     fileSystem // Where files are read from; osFS unless walking an fs.FS
+
+	root     string       // The path given to Walk
+	ignores  []ignoreRule // Parsed IgnorePatterns
+	includes []ignoreRule // Parsed IncludePatterns
+	keyMap   []keyRule    // Parsed KeyMap
+
+	// ctx is canceled when walking any entry fails, or when the context given to Walk is done, to
+	// stop the walk early.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// errs holds the errors of files that failed, if KeepGoing is set.
+	errs   Errors
+	errsMu sync.Mutex
+	// sources records where each file was placed in the result, if Manifest is set.
+	sources   map[string]source
+	sourcesMu sync.Mutex
+	// jobs holds a token for each goroutine walking entries in addition to the caller of Walk.
+	jobs chan struct{}
+}
+
+// addError records that the file at path failed with err.
+func (w *walker) addError(path string, err error) {
+	w.errsMu.Lock()
+	defer w.errsMu.Unlock()
+	w.errs = append(w.errs, &fs.PathError{Op: "walk", Path: path, Err: err})
+}
+
+func newWalker(ctx context.Context, opts Options) (*walker, error) {
+	discard := log.New(ioutil.Discard, "", 0)
+	w := &walker{
+		Options: opts,
+		log:     opts.Log,
+		errlog:  opts.ErrorLog,
+		fs:      osFS{},
+	}
+
+	if w.Manifest != nil {
+		w.sources = make(map[string]source)
+	}
+
+	if w.log == nil {
+		w.log = discard
+	}
+
+	if w.errlog == nil {
+		w.errlog = discard
+	}
+
+	if w.RelativeExec {
+		w.NoTempExec = true
+	}
+
+	if w.IntBase != 0 && (w.IntBase < 2 || w.IntBase > 36) {
+		return nil, fmt.Errorf("invalid integer base %d", w.IntBase)
+	}
+
+	for _, s := range w.IgnorePatterns {
+		rule := parseIgnoreRule(s, "")
+		if _, err := filepath.Match(rule.pattern, "."); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %v", s, err)
+		}
+		w.ignores = append(w.ignores, rule)
+	}
+
+	for _, s := range w.IncludePatterns {
+		rule := parseIgnoreRule(s, "")
+		if rule.negate {
+			return nil, fmt.Errorf("invalid include pattern %q: '!' isn't supported", s)
+		}
+		if _, err := filepath.Match(rule.pattern, "."); err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %v", s, err)
+		}
+		w.includes = append(w.includes, rule)
+	}
+
+	for _, s := range w.KeyMap {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid key mapping %q: must be PATTERN=KEY", s)
+		}
+		rule := keyRule{pattern: s[:i], key: s[i+1:]}
+		if _, err := filepath.Match(rule.pattern, "."); err != nil {
+			return nil, fmt.Errorf("invalid key mapping %q: %v", s, err)
+		}
+		w.keyMap = append(w.keyMap, rule)
+	}
+
+	if w.Jobs > 1 && w.DryRun == nil {
+		w.jobs = make(chan struct{}, w.Jobs-1)
+	}
+
+	w.ctx, w.cancel = context.WithCancel(ctx)
+
+	return w, nil
+}
@@ -0,0 +1,76 @@
+package jsondir
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files, keyed by slash-separated path, to a new temporary directory and returns
+// its path. Paths ending in a slash are empty directories.
+func writeTree(t testing.TB, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0777); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// toJSON returns the compact JSON encoding of v.
+func toJSON(t testing.TB, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// walkJSON walks root with opts and returns the JSON encoding of the result.
+func walkJSON(t testing.TB, root string, opts Options) string {
+	t.Helper()
+	v, err := Walk(root, opts)
+	if err != nil {
+		t.Fatalf("Walk(%q) = %v", root, err)
+	}
+	return toJSON(t, v)
+}
+
+// genTree writes a tree of directories width entries wide and depth levels deep to a new temporary
+// directory and returns its path. Each directory holds files of several types, an array directory,
+// and width subdirectories, unless it's at the bottom of the tree.
+func genTree(t testing.TB, width, depth int) string {
+	t.Helper()
+	files := make(map[string]string)
+	var gen func(dir string, depth int)
+	gen = func(dir string, depth int) {
+		for i := 0; i < width; i++ {
+			name := fmt.Sprintf("%s/f%d", dir, i)
+			files[name] = fmt.Sprint(i)
+			files[name+".str"] = fmt.Sprint("value ", i)
+			files[name+"@"] = fmt.Sprintf(`{"i": %d, "list": [1, 2.5, "three"]}`, i)
+			files[fmt.Sprintf("%s/list[]/%d", dir, i)] = fmt.Sprint(i%2 == 0)
+			if depth > 1 {
+				gen(fmt.Sprintf("%s/d%d", dir, i), depth-1)
+			}
+		}
+	}
+	gen("tree", depth)
+	return filepath.Join(writeTree(t, files), "tree")
+}
@@ -0,0 +1,77 @@
+package jsondir
+
+import "strings"
+
+// source records where the file or directory at a path was placed in the value of its parent
+// directory.
+type source struct {
+	parent string   // The path of the parent directory
+	tokens []string // The key or index of the value in its parent, and any keys nested in it
+}
+
+// addSource records that the file at path is the value at tokens in the directory at parent, if
+// Manifest is set. There's more than one token for keys nested by DotKeys.
+func (w *walker) addSource(path, parent string, tokens ...string) {
+	if w.Manifest == nil {
+		return
+	}
+	w.sourcesMu.Lock()
+	defer w.sourcesMu.Unlock()
+	w.sources[path] = source{parent: parent, tokens: tokens}
+}
+
+// fillManifest adds the JSON Pointer of every recorded file and directory in the result of a walk
+// to Manifest. Files whose parents were left out of the result, such as empty directories that
+// were skipped, aren't added. A directory ending in '!' has the same pointer as its entry, so the
+// entry, whose path is longer, is used.
+func (w *walker) fillManifest() {
+	paths := map[string]string{"": w.root}
+	for path := range w.sources {
+		if ptr, ok := w.pointer(path); ok && len(path) > len(paths[ptr]) {
+			paths[ptr] = path
+		}
+	}
+	for ptr, path := range paths {
+		w.Manifest[ptr] = w.sourcePath(path)
+	}
+}
+
+// pointer returns the JSON Pointer of the value of the file at path, and whether it's in the
+// result of the walk.
+func (w *walker) pointer(path string) (string, bool) {
+	var tokens []string
+	for path != w.root {
+		src, ok := w.sources[path]
+		if !ok {
+			return "", false
+		}
+		for i := len(src.tokens) - 1; i >= 0; i-- {
+			tokens = append(tokens, PointerToken(src.tokens[i]))
+		}
+		path = src.parent
+	}
+
+	var sb strings.Builder
+	for i := len(tokens) - 1; i >= 0; i-- {
+		sb.WriteString("/")
+		sb.WriteString(tokens[i])
+	}
+	return sb.String(), true
+}
+
+// PointerToken escapes key for use as a reference token in a JSON Pointer (RFC 6901), such as the
+// pointers of Options.Manifest.
+func PointerToken(key string) string {
+	return pointerEscaper.Replace(key)
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// sourcePath returns the path of the file at path for Manifest: its absolute path, unless walking
+// an fs.FS.
+func (w *walker) sourcePath(path string) string {
+	if w.fs == (osFS{}) {
+		return absPath(path)
+	}
+	return path
+}
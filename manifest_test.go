@@ -0,0 +1,65 @@
+package jsondir
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPointerToken(t *testing.T) {
+	cases := map[string]string{
+		"key":  "key",
+		"a/b":  "a~1b",
+		"a~b":  "a~0b",
+		"~/":   "~0~1",
+		"~1":   "~01",
+		"":     "",
+		"a.b":  "a.b",
+		"a//b": "a~1~1b",
+	}
+	for key, want := range cases {
+		if got := PointerToken(key); got != want {
+			t.Errorf("PointerToken(%q) = %q; want %q", key, got, want)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a/b~c":     "1",
+		"list[]/0":  "x",
+		"list[]/1@": `{"y": 2}`,
+		"one!/only": "3",
+		"d.e":       "4",
+	})
+
+	manifest := make(map[string]string)
+	if _, err := Walk(root, Options{Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"":        abs,
+		"/a":      filepath.Join(abs, "a"),
+		"/a/b~0c": filepath.Join(abs, "a", "b~c"),
+		"/d.e":    filepath.Join(abs, "d.e"),
+		"/list":   filepath.Join(abs, "list[]"),
+		"/list/0": filepath.Join(abs, "list[]", "0"),
+		"/list/1": filepath.Join(abs, "list[]", "1@"),
+		"/one":    filepath.Join(abs, "one!", "only"),
+	}
+	if got, want := toJSON(t, manifest), toJSON(t, want); got != want {
+		t.Errorf("Manifest = %s; want %s", got, want)
+	}
+
+	manifest = make(map[string]string)
+	if _, err := Walk(root, Options{Manifest: manifest, DotKeys: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := manifest["/d/e"], filepath.Join(abs, "d.e"); got != want {
+		t.Errorf("Manifest[/d/e] with DotKeys = %q; want %q", got, want)
+	}
+}
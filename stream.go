@@ -0,0 +1,252 @@
+package jsondir
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StreamEncode writes the JSON encoding of the file or directory at root to out, followed by a
+// newline, as Walk would convert it. Unlike encoding the result of Walk, it doesn't hold the whole
+// result in memory: each directory's entries are written as they're walked, one at a time, so only
+// the value of a single file is held at once. Object keys are written in sorted order, as by
+// encoding/json.
+//
+// A directory's entries are walked in order regardless of Options.Jobs. Directories whose values
+// depend on all of their entries at once, such as those ending in '!' and every directory if
+// Options.DotKeys is set, are walked as by Walk and written whole. Duplicate keys are resolved
+// before any of their files are walked, so if the file used for a key is skipped, the key is left
+// out rather than taken from another file.
+//
+// If the walk fails, out may hold part of the result. As with Walk, if root itself is skipped,
+// StreamEncode returns a SkipFile error, and if Options.KeepGoing is set and any files failed, it
+// returns an Errors after writing the rest of them.
+func StreamEncode(out io.Writer, root string, opts Options) error {
+	return StreamEncodeContext(context.Background(), out, root, opts)
+}
+
+// StreamEncodeContext is like StreamEncode, but stops walking and kills any running executables if
+// ctx is done first, in which case it returns ctx.Err().
+func StreamEncodeContext(ctx context.Context, out io.Writer, root string, opts Options) error {
+	w, err := newWalker(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer w.cancel()
+	w.root = root
+
+	s := &streamer{walker: w, out: bufio.NewWriter(out)}
+	err = s.stream(nil, root, nil, nil)
+	if err == nil {
+		err = s.write([]byte("\n"))
+	}
+	if ferr := s.out.Flush(); err == nil {
+		err = ferr
+	}
+
+	if w.Manifest != nil && (err == nil || len(w.errs) > 0) {
+		w.fillManifest()
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ctx.Err()
+	case err == nil && len(w.errs) > 0:
+		sort.Slice(w.errs, func(i, j int) bool { return w.errs[i].Path < w.errs[j].Path })
+		return w.errs
+	}
+	return err
+}
+
+// streamer writes the values of files as they're walked.
+type streamer struct {
+	*walker
+	out     *bufio.Writer
+	written int64 // The number of bytes written to out
+}
+
+// write writes each of bs to out.
+func (s *streamer) write(bs ...[]byte) error {
+	for _, b := range bs {
+		n, err := s.out.Write(b)
+		s.written += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeValue writes prefix followed by the JSON encoding of v.
+func (s *streamer) writeValue(prefix []byte, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(prefix, b)
+}
+
+// stream writes prefix followed by the value of the file fi at loc, in the directory parent. If the
+// file is skipped or fails before anything is written, neither is written.
+func (s *streamer) stream(fi os.FileInfo, loc string, parent *dirFrame, prefix []byte) error {
+	if s.DryRun == nil && !s.DotKeys && !strings.HasSuffix(loc, "!") && s.follow(loc) == nil {
+		// Entries from a directory describe symlinks, not their targets. Errors are left to
+		// walkValue.
+		dir := fi
+		if dir == nil || dir.Mode()&os.ModeSymlink != 0 {
+			dir, _ = s.fs.Stat(loc)
+		}
+		if dir != nil && dir.IsDir() {
+			return s.streamDir(dir, loc, parent, prefix)
+		}
+	}
+
+	v, err := s.walkValue(fi, loc, parent)
+	if err != nil {
+		return err
+	}
+	return s.writeValue(prefix, v)
+}
+
+// streamDir writes prefix followed by the value of the directory fi at loc, in the directory
+// parent, writing each of its entries as it's walked. Nothing is written until the directory's
+// first entry is, so that an empty directory can still be skipped.
+func (s *streamer) streamDir(fi os.FileInfo, loc string, parent *dirFrame, prefix []byte) error {
+	l, value, err := s.listDir(fi, loc, parent)
+	if err != nil {
+		return err
+	} else if l == nil {
+		return s.writeValue(prefix, value)
+	}
+
+	entries, err := s.streamEntries(l)
+	if err != nil {
+		return err
+	}
+
+	open, close := []byte("{"), []byte("}")
+	if l.isArray {
+		open, close = []byte("["), []byte("]")
+	}
+
+	// The directory's metadata is written like any other entry, but only once another entry has
+	// been, since it's left out of empty directories unless EmptyDir is EmptyDirKeep.
+	var meta []byte
+	n := 0
+	for _, e := range entries {
+		if e.fi == nil {
+			b, err := json.Marshal(fileMeta(fi))
+			if err != nil {
+				return err
+			}
+			meta = append([]byte(`"_meta":`), b...)
+			if n > 0 {
+				if err := s.write([]byte(","), meta); err != nil {
+					return err
+				}
+				meta = nil
+			}
+			continue
+		}
+
+		var p []byte
+		if n == 0 {
+			p = append(append(p, prefix...), open...)
+			if meta != nil {
+				p = append(append(p, meta...), ',')
+				meta = nil
+			}
+		} else {
+			p = []byte(",")
+		}
+		if !l.isArray {
+			key, _ := json.Marshal(e.key)
+			p = append(append(p, key...), ':')
+		}
+
+		before := s.written
+		switch err := s.stream(e.fi, e.path, l.frame, p); {
+		case err != nil && s.written != before:
+			// Part of the entry was written, so it can't be left out.
+			return err
+		case IsSkip(err):
+			s.log.Print(err)
+			continue
+		case err != nil && s.KeepGoing && err != context.Canceled:
+			s.addError(e.path, err)
+			continue
+		case err != nil:
+			s.errlog.Print("unable to load file at path ", e.path, ": ", err)
+			return err
+		}
+
+		if l.isArray {
+			s.addSource(e.path, loc, strconv.Itoa(n))
+		} else {
+			s.addSource(e.path, loc, e.key)
+		}
+		n++
+	}
+
+	if n > 0 {
+		return s.write(close)
+	}
+
+	switch {
+	case len(s.includes) > 0 && parent != nil:
+		// Prune directories without any included files, other than the root.
+		return SkipFile(loc + " (no included files)")
+	case s.EmptyDir != EmptyDirKeep:
+		if value, err = s.emptyDir(loc); err != nil {
+			return err
+		}
+		return s.writeValue(prefix, value)
+	case l.isArray:
+		return s.write(prefix, []byte("null"))
+	}
+	return s.write(prefix, open, meta, close)
+}
+
+// streamEntries returns the entries of the directory listed by l in the order they're written.
+// Object entries are sorted by key, with only one entry for each key according to Duplicates, and
+// an entry without a FileInfo for the directory's "_meta" key if Meta is set.
+func (s *streamer) streamEntries(l *dirListing) ([]dirEntry, error) {
+	if l.isArray {
+		return l.entries, nil
+	}
+
+	entries := make([]dirEntry, 0, len(l.entries)+1)
+	index := make(map[string]int, len(l.entries)) // The index of each key in entries
+	for _, e := range l.entries {
+		i, ok := index[e.key]
+		if !ok {
+			index[e.key] = len(entries)
+			entries = append(entries, e)
+			continue
+		}
+
+		// Entries are in lexical order, so the one already in entries sorts first.
+		prev := entries[i].path
+		err := fmt.Errorf("duplicate key %q from %s and %s", e.key, prev, e.path)
+		switch {
+		case s.Strict || s.Duplicates == DuplicateError:
+			return nil, err
+		case s.Duplicates == DuplicateFirst:
+			s.errlog.Print(err, ": using ", prev)
+		default:
+			s.errlog.Print(err, ": using ", e.path)
+			entries[i] = e
+		}
+	}
+
+	if _, ok := index["_meta"]; s.Meta && !ok {
+		entries = append(entries, dirEntry{key: "_meta"})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries, nil
+}
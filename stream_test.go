@@ -0,0 +1,75 @@
+package jsondir
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStreamEncode(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a/b":         "1",
+		"a/c.str":     "two",
+		"a/empty/":    "",
+		"list[]/0":    "x",
+		"list[]/1@":   `{"y": [1, 2]}`,
+		"list[]/2/z":  "true",
+		"one!/only":   "3",
+		"d.e":         "4",
+		"dup":         "5",
+		"dup@":        "6",
+		"obj{}/k":     "v",
+		"blank":       "  ",
+		"empty[]/":    "",
+		"nested/x/y/": "",
+	})
+
+	variants := []Options{
+		{},
+		{Meta: true},
+		{DotKeys: true},
+		{Empty: EmptySkip},
+		{EmptyDir: EmptyDirSkip},
+		{Duplicates: DuplicateFirst},
+		{MaxDepth: 2},
+		{DefaultArray: true},
+		{KeyCase: KeyCaseUpper},
+	}
+
+	for _, opts := range variants {
+		v, err := Walk(root, opts)
+		if err != nil {
+			t.Fatalf("Walk() with %+v = %v", opts, err)
+		}
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := StreamEncode(&buf, root, opts); err != nil {
+			t.Fatalf("StreamEncode() with %+v = %v", opts, err)
+		}
+		if got := bytes.TrimSuffix(buf.Bytes(), []byte("\n")); !bytes.Equal(got, want) {
+			t.Errorf("StreamEncode() with %+v = %s; want %s", opts, got, want)
+		}
+	}
+}
+
+func TestStreamEncodeError(t *testing.T) {
+	root := writeTree(t, map[string]string{"a": "1", "bad@": "{"})
+
+	var buf bytes.Buffer
+	if err := StreamEncode(&buf, root, Options{}); err == nil {
+		t.Fatalf("StreamEncode() = nil; want an error for invalid JSON")
+	}
+
+	buf.Reset()
+	err := StreamEncode(&buf, root, Options{KeepGoing: true})
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 {
+		t.Fatalf("StreamEncode() with KeepGoing = %v; want one error", err)
+	}
+	if got, want := buf.String(), "{\"a\":1}\n"; got != want {
+		t.Errorf("StreamEncode() with KeepGoing wrote %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,578 @@
+package jsondir
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlDecoder decodes a TOML document into the values Walk produces: bool, int64, float64, string,
+// []interface{}, and map[string]interface{}. Dates and times are strings as written, and infinite
+// and NaN floats, which JSON can't represent, are an error.
+type tomlDecoder struct {
+	s    string
+	pos  int
+	line int
+}
+
+// tomlTable is a table while it's being decoded.
+type tomlTable struct {
+	m       map[string]interface{} // *tomlTable, *tomlArrayTables, or a value
+	defined bool                   // Whether the table has a header or is defined by dotted keys
+	inline  bool                   // Whether the table is an inline table, which can't be extended
+}
+
+// tomlArrayTables is an array of tables defined by [[headers]].
+type tomlArrayTables struct {
+	tables []*tomlTable
+}
+
+func newTOMLTable() *tomlTable {
+	return &tomlTable{m: make(map[string]interface{})}
+}
+
+// tomlError is an error decoding a TOML document.
+type tomlError struct {
+	line int
+	msg  string
+}
+
+func (e *tomlError) Error() string {
+	return fmt.Sprintf("invalid TOML: line %d: %s", e.line, e.msg)
+}
+
+// decodeTOML decodes the TOML document in data.
+func decodeTOML(data []byte) (v interface{}, err error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("invalid TOML: not valid UTF-8")
+	}
+
+	d := &tomlDecoder{s: string(data), line: 1}
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case *tomlError:
+			v, err = nil, r
+		default:
+			panic(r)
+		}
+	}()
+	return d.document().value(), nil
+}
+
+// value converts the table to a map[string]interface{}.
+func (t *tomlTable) value() map[string]interface{} {
+	m := make(map[string]interface{}, len(t.m))
+	for k, v := range t.m {
+		m[k] = tomlValue(v)
+	}
+	return m
+}
+
+// tomlValue converts a decoded value, which may hold tables, to a value Walk produces.
+func tomlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *tomlTable:
+		return v.value()
+	case *tomlArrayTables:
+		ary := make([]interface{}, len(v.tables))
+		for i, t := range v.tables {
+			ary[i] = t.value()
+		}
+		return ary
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = tomlValue(elem)
+		}
+	}
+	return v
+}
+
+// fail stops decoding with an error at the current line.
+func (d *tomlDecoder) fail(format string, args ...interface{}) {
+	panic(&tomlError{line: d.line, msg: fmt.Sprintf(format, args...)})
+}
+
+func (d *tomlDecoder) eof() bool {
+	return d.pos >= len(d.s)
+}
+
+func (d *tomlDecoder) peek() byte {
+	if d.eof() {
+		return 0
+	}
+	return d.s[d.pos]
+}
+
+// skipSpace skips spaces and tabs.
+func (d *tomlDecoder) skipSpace() {
+	for !d.eof() && (d.s[d.pos] == ' ' || d.s[d.pos] == '\t') {
+		d.pos++
+	}
+}
+
+// skipComment skips a comment, if there is one, up to the end of its line.
+func (d *tomlDecoder) skipComment() {
+	if d.peek() == '#' {
+		for !d.eof() && d.s[d.pos] != '\n' {
+			d.pos++
+		}
+	}
+}
+
+// newline consumes a line ending and returns whether there was one.
+func (d *tomlDecoder) newline() bool {
+	switch {
+	case strings.HasPrefix(d.s[d.pos:], "\n"):
+		d.pos++
+	case strings.HasPrefix(d.s[d.pos:], "\r\n"):
+		d.pos += 2
+	default:
+		return false
+	}
+	d.line++
+	return true
+}
+
+// skipBlank skips whitespace, comments, and line endings.
+func (d *tomlDecoder) skipBlank() {
+	for {
+		d.skipSpace()
+		d.skipComment()
+		if !d.newline() {
+			return
+		}
+	}
+}
+
+// endLine consumes the end of a line after a header or key/value pair.
+func (d *tomlDecoder) endLine() {
+	d.skipSpace()
+	d.skipComment()
+	if !d.eof() && !d.newline() {
+		d.fail("expected the end of the line, found %q", d.peek())
+	}
+}
+
+func (d *tomlDecoder) expect(c byte) {
+	if d.peek() != c {
+		d.fail("expected %q", c)
+	}
+	d.pos++
+}
+
+func (d *tomlDecoder) document() *tomlTable {
+	root := newTOMLTable()
+	current := root
+	for {
+		d.skipBlank()
+		if d.eof() {
+			return root
+		}
+
+		if d.peek() != '[' {
+			d.keyValue(current)
+			d.endLine()
+			continue
+		}
+
+		d.pos++
+		array := d.peek() == '['
+		if array {
+			d.pos++
+		}
+		d.skipSpace()
+		keys := d.key()
+		d.expect(']')
+		if array {
+			d.expect(']')
+			current = d.arrayTable(root, keys)
+		} else {
+			current = d.table(root, keys)
+		}
+		d.endLine()
+	}
+}
+
+// descend returns the table at keys in t, creating implicit tables as needed.
+func (d *tomlDecoder) descend(t *tomlTable, keys []string) *tomlTable {
+	for _, k := range keys {
+		switch v := t.m[k].(type) {
+		case nil:
+			next := newTOMLTable()
+			t.m[k] = next
+			t = next
+		case *tomlTable:
+			if v.inline {
+				d.fail("inline table %q can't be extended", k)
+			}
+			t = v
+		case *tomlArrayTables:
+			t = v.tables[len(v.tables)-1]
+		default:
+			d.fail("key %q is already defined", k)
+		}
+	}
+	return t
+}
+
+// table returns the table for the header [keys].
+func (d *tomlDecoder) table(root *tomlTable, keys []string) *tomlTable {
+	parent := d.descend(root, keys[:len(keys)-1])
+	last := keys[len(keys)-1]
+	switch v := parent.m[last].(type) {
+	case nil:
+		t := newTOMLTable()
+		t.defined = true
+		parent.m[last] = t
+		return t
+	case *tomlTable:
+		if !v.defined && !v.inline {
+			v.defined = true
+			return v
+		}
+	}
+	d.fail("table %q is already defined", strings.Join(keys, "."))
+	return nil
+}
+
+// arrayTable returns a new table appended to the array of tables for the header [[keys]].
+func (d *tomlDecoder) arrayTable(root *tomlTable, keys []string) *tomlTable {
+	parent := d.descend(root, keys[:len(keys)-1])
+	last := keys[len(keys)-1]
+	t := newTOMLTable()
+	switch v := parent.m[last].(type) {
+	case nil:
+		parent.m[last] = &tomlArrayTables{tables: []*tomlTable{t}}
+	case *tomlArrayTables:
+		v.tables = append(v.tables, t)
+	default:
+		d.fail("key %q is already defined", strings.Join(keys, "."))
+	}
+	return t
+}
+
+// keyValue decodes a key/value pair into t.
+func (d *tomlDecoder) keyValue(t *tomlTable) {
+	keys := d.key()
+	d.expect('=')
+	d.skipSpace()
+	v := d.value()
+
+	for _, k := range keys[:len(keys)-1] {
+		switch next := t.m[k].(type) {
+		case nil:
+			sub := newTOMLTable()
+			sub.defined = true
+			t.m[k] = sub
+			t = sub
+		case *tomlTable:
+			if next.inline {
+				d.fail("inline table %q can't be extended", k)
+			}
+			t = next
+		default:
+			d.fail("key %q is already defined", k)
+		}
+	}
+
+	last := keys[len(keys)-1]
+	if _, ok := t.m[last]; ok {
+		d.fail("key %q is already defined", strings.Join(keys, "."))
+	}
+	t.m[last] = v
+}
+
+// key decodes a possibly dotted key and the whitespace after it.
+func (d *tomlDecoder) key() []string {
+	var keys []string
+	for {
+		d.skipSpace()
+		switch c := d.peek(); {
+		case c == '"':
+			keys = append(keys, d.basicString())
+		case c == '\'':
+			keys = append(keys, d.literalString())
+		default:
+			start := d.pos
+			for !d.eof() && isTOMLBareKey(d.s[d.pos]) {
+				d.pos++
+			}
+			if start == d.pos {
+				d.fail("expected a key")
+			}
+			keys = append(keys, d.s[start:d.pos])
+		}
+		d.skipSpace()
+		if d.peek() != '.' {
+			return keys
+		}
+		d.pos++
+	}
+}
+
+func isTOMLBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (d *tomlDecoder) value() interface{} {
+	switch c := d.peek(); {
+	case strings.HasPrefix(d.s[d.pos:], `"""`):
+		return d.multilineString(`"""`)
+	case strings.HasPrefix(d.s[d.pos:], `'''`):
+		return d.multilineString(`'''`)
+	case c == '"':
+		return d.basicString()
+	case c == '\'':
+		return d.literalString()
+	case c == '[':
+		return d.array()
+	case c == '{':
+		return d.inlineTable()
+	case strings.HasPrefix(d.s[d.pos:], "true"):
+		d.pos += 4
+		return true
+	case strings.HasPrefix(d.s[d.pos:], "false"):
+		d.pos += 5
+		return false
+	case c == 0:
+		d.fail("expected a value")
+	}
+	return d.scalar()
+}
+
+func (d *tomlDecoder) array() interface{} {
+	d.pos++
+	ary := []interface{}{}
+	for {
+		d.skipBlank()
+		if d.peek() == ']' {
+			d.pos++
+			return ary
+		}
+		ary = append(ary, d.value())
+		d.skipBlank()
+		switch d.peek() {
+		case ',':
+			d.pos++
+		case ']':
+			d.pos++
+			return ary
+		default:
+			d.fail("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (d *tomlDecoder) inlineTable() interface{} {
+	d.pos++
+	t := newTOMLTable()
+	d.skipSpace()
+	if d.peek() == '}' {
+		d.pos++
+		t.inline = true
+		return t
+	}
+	for {
+		d.keyValue(t)
+		d.skipSpace()
+		switch d.peek() {
+		case ',':
+			d.pos++
+		case '}':
+			d.pos++
+			t.inline = true
+			return t
+		default:
+			d.fail("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+// basicString decodes a string in double quotes.
+func (d *tomlDecoder) basicString() string {
+	d.pos++
+	var sb strings.Builder
+	for !d.eof() {
+		switch c := d.s[d.pos]; c {
+		case '"':
+			d.pos++
+			return sb.String()
+		case '\\':
+			d.escape(&sb)
+		case '\n':
+			d.fail("unterminated string")
+		default:
+			sb.WriteByte(c)
+			d.pos++
+		}
+	}
+	d.fail("unterminated string")
+	return ""
+}
+
+// literalString decodes a string in single quotes.
+func (d *tomlDecoder) literalString() string {
+	d.pos++
+	end := strings.IndexAny(d.s[d.pos:], "'\n")
+	if end < 0 || d.s[d.pos+end] != '\'' {
+		d.fail("unterminated string")
+	}
+	s := d.s[d.pos : d.pos+end]
+	d.pos += end + 1
+	return s
+}
+
+// multilineString decodes a string delimited by three double or single quotes. A line ending right
+// after the opening delimiter is trimmed.
+func (d *tomlDecoder) multilineString(delim string) string {
+	d.pos += len(delim)
+	d.newline()
+
+	var sb strings.Builder
+	for !d.eof() {
+		if strings.HasPrefix(d.s[d.pos:], delim) {
+			// Up to two quotes may come right before the closing delimiter.
+			for i := 0; i < 2 && strings.HasPrefix(d.s[d.pos+1:], delim); i++ {
+				sb.WriteByte(delim[0])
+				d.pos++
+			}
+			d.pos += len(delim)
+			return sb.String()
+		}
+
+		switch c := d.s[d.pos]; {
+		case c == '\\' && delim == `"""`:
+			if d.lineEndingBackslash() {
+				continue
+			}
+			d.escape(&sb)
+		case c == '\n':
+			sb.WriteByte('\n')
+			d.pos++
+			d.line++
+		case c == '\r' && strings.HasPrefix(d.s[d.pos:], "\r\n"):
+			d.pos++
+		default:
+			sb.WriteByte(c)
+			d.pos++
+		}
+	}
+	d.fail("unterminated string")
+	return ""
+}
+
+// lineEndingBackslash skips a backslash at the end of a line, and the whitespace and line endings
+// after it, and returns whether there was one.
+func (d *tomlDecoder) lineEndingBackslash() bool {
+	rest := strings.TrimLeft(d.s[d.pos+1:], " \t")
+	if !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "\r\n") {
+		return false
+	}
+	d.pos = len(d.s) - len(rest)
+	for {
+		d.skipSpace()
+		if !d.newline() {
+			return true
+		}
+	}
+}
+
+// escape decodes the escape sequence at the current position into sb.
+func (d *tomlDecoder) escape(sb *strings.Builder) {
+	if d.pos+1 >= len(d.s) {
+		d.fail("invalid escape sequence")
+	}
+
+	c := d.s[d.pos+1]
+	if r, ok := tomlEscapes[c]; ok {
+		sb.WriteByte(r)
+		d.pos += 2
+		return
+	}
+
+	size := map[byte]int{'u': 4, 'U': 8}[c]
+	if size == 0 || d.pos+2+size > len(d.s) {
+		d.fail("invalid escape sequence %q", d.s[d.pos:d.pos+2])
+	}
+	hex := d.s[d.pos+2 : d.pos+2+size]
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || n > utf8.MaxRune || n >= 0xD800 && n <= 0xDFFF {
+		d.fail("invalid escape sequence %q", d.s[d.pos:d.pos+2+size])
+	}
+	sb.WriteRune(rune(n))
+	d.pos += 2 + size
+}
+
+// tomlEscapes are the single-character escape sequences of basic strings.
+var tomlEscapes = map[byte]byte{
+	'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', 'e': '\x1b', '"': '"', '\\': '\\',
+}
+
+var (
+	tomlDecimal = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$`)
+	tomlHex     = regexp.MustCompile(`^0x[0-9a-fA-F](_?[0-9a-fA-F])*$`)
+	tomlOctal   = regexp.MustCompile(`^0o[0-7](_?[0-7])*$`)
+	tomlBinary  = regexp.MustCompile(`^0b[01](_?[01])*$`)
+	tomlFloat   = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+	tomlSpecial = regexp.MustCompile(`^[-+]?(inf|nan)$`)
+	tomlDate    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[-+]\d{2}:\d{2})?)?$`)
+	tomlTime    = regexp.MustCompile(`^\d{2}:\d{2}(:\d{2}(\.\d+)?)?$`)
+)
+
+// scalar decodes a number, date, or time.
+func (d *tomlDecoder) scalar() interface{} {
+	start := d.pos
+	for !d.eof() && strings.IndexByte("0123456789abcdefABCDEFinxobtzTZ_+-.:", d.s[d.pos]) >= 0 {
+		d.pos++
+	}
+	// Dates may be separated from times by a space.
+	if tomlDate.MatchString(d.s[start:d.pos]) && d.pos+3 < len(d.s) && d.s[d.pos] == ' ' &&
+		isDigit(d.s[d.pos+1]) && isDigit(d.s[d.pos+2]) && d.s[d.pos+3] == ':' {
+		d.pos++
+		for !d.eof() && strings.IndexByte("0123456789zZ+-.:", d.s[d.pos]) >= 0 {
+			d.pos++
+		}
+	}
+
+	tok := d.s[start:d.pos]
+	switch {
+	case tok == "":
+		d.fail("expected a value")
+	case tomlDecimal.MatchString(tok):
+		return d.parseInt(tok, 10)
+	case tomlHex.MatchString(tok):
+		return d.parseInt(tok[2:], 16)
+	case tomlOctal.MatchString(tok):
+		return d.parseInt(tok[2:], 8)
+	case tomlBinary.MatchString(tok):
+		return d.parseInt(tok[2:], 2)
+	case tomlFloat.MatchString(tok):
+		f64, err := strconv.ParseFloat(strings.Replace(tok, "_", "", -1), 64)
+		if err != nil || math.IsInf(f64, 0) {
+			d.fail("invalid float %q", tok)
+		}
+		return f64
+	case tomlSpecial.MatchString(tok):
+		d.fail("%s can't be represented in JSON", tok)
+	case tomlDate.MatchString(tok), tomlTime.MatchString(tok):
+		return tok
+	}
+	d.fail("invalid value %q", tok)
+	return nil
+}
+
+func (d *tomlDecoder) parseInt(s string, base int) int64 {
+	i64, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), base, 64)
+	if err != nil {
+		d.fail("invalid integer %q", s)
+	}
+	return i64
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
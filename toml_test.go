@@ -0,0 +1,106 @@
+package jsondir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeTOML(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Scalars
+		{"empty", "", `{}`},
+		{"string", `a = "b"`, `{"a":"b"}`},
+		{"escapes", `a = "tab\there\n\u00e9\U0001F600\"\\"`, `{"a":"tab\there\né😀\"\\"}`},
+		{"literal string", `a = 'C:\path'`, `{"a":"C:\\path"}`},
+		{"int", "a = 42\nb = -7\nc = +3\nd = 1_000", `{"a":42,"b":-7,"c":3,"d":1000}`},
+		{"prefixed ints", "a = 0xff\nb = 0o17\nc = 0b101", `{"a":255,"b":15,"c":5}`},
+		{"float", "a = 1.5\nb = 1e3\nc = -2.5E-1\nd = 1_000.5", `{"a":1.5,"b":1000,"c":-0.25,"d":1000.5}`},
+		{"bool", "a = true\nb = false", `{"a":true,"b":false}`},
+		{"datetime", "a = 1979-05-27T07:32:00Z\nb = 1979-05-27\nc = 07:32:00",
+			`{"a":"1979-05-27T07:32:00Z","b":"1979-05-27","c":"07:32:00"}`},
+
+		// Keys and tables
+		{"quoted keys", `"a b" = 1` + "\n'c.d' = 2", `{"a b":1,"c.d":2}`},
+		{"dotted keys", "a.b.c = 1\na.d = 2", `{"a":{"b":{"c":1},"d":2}}`},
+		{"tables", "top = 0\n[a]\nx = 1\n[a.b]\ny = 2\n[c]\nz = 3", `{"a":{"b":{"y":2},"x":1},"c":{"z":3},"top":0}`},
+		{"implicit table", "[a.b.c]\nx = 1\n[a]\ny = 2", `{"a":{"b":{"c":{"x":1}},"y":2}}`},
+		{"array of tables", "[[p]]\nn = 1\n[[p]]\nn = 2\n[p.q]\nm = 3", `{"p":[{"n":1},{"n":2,"q":{"m":3}}]}`},
+
+		// Collections
+		{"array", `a = [1, "two", [3, 4], {x = 5}]`, `{"a":[1,"two",[3,4],{"x":5}]}`},
+		{"multi-line array", "a = [\n  1, # one\n  2,\n]", `{"a":[1,2]}`},
+		{"inline table", `a = {x = 1, y.z = "w"}`, `{"a":{"x":1,"y":{"z":"w"}}}`},
+		{"empty collections", "a = []\nb = {}", `{"a":[],"b":{}}`},
+
+		// Multi-line strings
+		{"multi-line basic", "a = \"\"\"\none\ntwo\"\"\"", `{"a":"one\ntwo"}`},
+		{"line ending backslash", "a = \"\"\"\none \\\n    two\"\"\"", `{"a":"one two"}`},
+		{"multi-line literal", "a = '''\none\\n\ntwo'''", `{"a":"one\\n\ntwo"}`},
+		{"quotes in multi-line", `a = """say "hi"."""`, `{"a":"say \"hi\"."}`},
+
+		// Comments
+		{"comments", "# head\na = 1 # one\n[t] # table\nb = \"# not a comment\"", `{"a":1,"t":{"b":"# not a comment"}}`},
+		{"CRLF", "a = 1\r\nb = 2\r\n", `{"a":1,"b":2}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := decodeTOML([]byte(c.in))
+			if err != nil {
+				t.Fatalf("decodeTOML(%q) = %v", c.in, err)
+			}
+			if got := toJSON(t, v); got != c.want {
+				t.Errorf("decodeTOML(%q) = %s; want %s", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTOMLErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"missing equals", "a 1", "line 1"},
+		{"missing value", "a =", "line 1"},
+		{"duplicate key", "a = 1\na = 2", "line 2"},
+		{"duplicate table", "[a]\n[a]", "line 2"},
+		{"extend inline table", "a = {x = 1}\na.y = 2", "line 2"},
+		{"unterminated string", `a = "b`, "line 1"},
+		{"unterminated array", "a = [1, 2", ""},
+		{"invalid escape", `a = "\q"`, "line 1"},
+		{"invalid integer", "a = 01", "line 1"},
+		{"invalid value", "a = nope", "line 1"},
+		{"infinity", "a = inf", "line 1"},
+		{"nan", "a = nan", "line 1"},
+		{"trailing content", "a = 1 2", "line 1"},
+		{"newline in string", "a = \"b\nc\"", "line 1"},
+		{"empty bare key", "= 1", "line 1"},
+		{"empty dotted key", "a. = 1", "line 1"},
+		{"empty table header", "[]\na = 1", "line 1"},
+		{"unterminated table header", "[a\nb = 1", "line 1"},
+		{"unterminated inline table", "a = {x = 1", ""},
+		{"unterminated multi-line string", "a = \"\"\"b", ""},
+		{"table over key", "a = 1\n[a]", "line 2"},
+		{"array table over table", "[a]\n[[a]]", "line 2"},
+		{"invalid float", "a = 1.", "line 1"},
+		{"invalid unicode escape", `a = "\uD800"`, "line 1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := decodeTOML([]byte(c.in))
+			if err == nil {
+				t.Fatalf("decodeTOML(%q) = %s; want an error", c.in, toJSON(t, v))
+			}
+			if !strings.Contains(err.Error(), c.err) {
+				t.Errorf("decodeTOML(%q) = %v; want an error containing %q", c.in, err, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package jsondir
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Unpack writes v out as a file or directory tree at path, such that calling Walk on the result
+// with the same Options reproduces v, provided v holds only values Walk can produce. This is the
+// inverse of Walk: objects become directories,
+// arrays become directories with a "[]" suffix whose entries are named by their zero-padded
+// index, and scalars become files containing their string form. Scalars that Walk wouldn't read
+// back as the same value are written as raw JSON to files with an '@' suffix.
+//
+// Keys ending in an '@', '!', "[]", "{}", or a type hint suffix are escaped by appending "{}" to
+// directory names and by writing files as raw JSON, so that Walk's suffix trimming restores the
+// original key. Raw JSON files whose keys end in a raw format suffix, such as ".yaml" or ".toml",
+// are also given a ".yaml" suffix, since JSON scalars are valid YAML. With Options.DefaultArray,
+// every object directory's name ends in "{}". Keys that can't be represented as a file name, that
+// would be ignored by Options.IgnorePatterns or left out by Options.IncludePatterns, or that are
+// the name of one of Options.IgnoreFiles, are an error, as are files larger than Options.MaxSize.
+//
+// Options that change keys or wrap values can't be reversed, so Options.RawKeys, KeyCase,
+// StripExt, StripExts, KeyMap, DotKeys, Gzip, Meta, and AllowExecute are an error. Options that
+// only apply to walking, such as Jobs, MaxDepth, and DryRun, are ignored.
+//
+// Because suffixes may be appended to path, Unpack returns the path actually written. Unpack never
+// overwrites existing files or directories.
+func Unpack(path string, v interface{}, opts Options) (string, error) {
+	if err := checkUnpackOptions(opts); err != nil {
+		return "", err
+	}
+
+	w, err := newWalker(context.Background(), opts)
+	if err != nil {
+		return "", err
+	}
+	defer w.cancel()
+	w.root = path
+
+	// Only the array suffix of the root matters to Walk, so don't escape its name like a key.
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if strings.HasSuffix(path, "[]") || strings.HasSuffix(path, "!") {
+			path += "{}"
+		} else if w.DefaultArray && !strings.HasSuffix(path, "{}") {
+			path += "{}"
+		}
+	case []interface{}:
+		if len(v) > 0 && !strings.HasSuffix(path, "[]") {
+			path += "[]"
+		}
+	}
+
+	return w.unpack(path, v)
+}
+
+// checkUnpackOptions returns an error naming the first option set in opts that Unpack can't honor.
+func checkUnpackOptions(opts Options) error {
+	unsupported := []struct {
+		name string
+		set  bool
+	}{
+		{"RawKeys", opts.RawKeys},
+		{"KeyCase", opts.KeyCase != KeyCaseKeep},
+		{"StripExt", opts.StripExt},
+		{"StripExts", len(opts.StripExts) > 0},
+		{"KeyMap", len(opts.KeyMap) > 0},
+		{"DotKeys", opts.DotKeys},
+		{"Gzip", opts.Gzip},
+		{"Meta", opts.Meta},
+		{"AllowExecute", opts.AllowExecute},
+	}
+	for _, o := range unsupported {
+		if o.set {
+			return fmt.Errorf("cannot unpack with %s set", o.name)
+		}
+	}
+	return nil
+}
+
+// unpackName returns the file name to use for key when unpacking v into a directory.
+func (w *walker) unpackName(key string, v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if w.DefaultArray || strings.HasSuffix(key, "@") || strings.HasSuffix(key, "!") || strings.HasSuffix(key, "[]") || strings.HasSuffix(key, "{}") {
+			return key + "{}"
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			return key + "[]"
+		}
+	}
+	return key
+}
+
+// unpackDir returns whether v is unpacked as a directory.
+func unpackDir(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+func (w *walker) unpack(path string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if err := os.Mkdir(path, 0777); err != nil {
+			return "", err
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := checkUnpackKey(k); err != nil {
+				return "", fmt.Errorf("cannot unpack key %q in %s: %v", k, path, err)
+			}
+
+			sub := filepath.Join(path, w.unpackName(k, v[k]))
+			if err := w.checkUnpackFile(sub, unpackDir(v[k])); err != nil {
+				return "", fmt.Errorf("cannot unpack key %q in %s: %v", k, path, err)
+			}
+
+			if _, err := w.unpack(sub, v[k]); err != nil {
+				return "", err
+			}
+		}
+
+	case []interface{}:
+		// Walk produces null for empty array directories, so write empty arrays as raw JSON.
+		if len(v) == 0 {
+			return w.unpackFile(path, []byte("[]"), true)
+		}
+
+		if err := os.Mkdir(path, 0777); err != nil {
+			return "", err
+		}
+
+		width := len(strconv.Itoa(len(v) - 1))
+		for i, elem := range v {
+			sub := filepath.Join(path, w.unpackName(fmt.Sprintf("%0*d", width, i), elem))
+			if err := w.checkUnpackFile(sub, unpackDir(elem)); err != nil {
+				return "", fmt.Errorf("cannot unpack index %d in %s: %v", i, path, err)
+			}
+
+			if _, err := w.unpack(sub, elem); err != nil {
+				return "", err
+			}
+		}
+
+	default:
+		data, raw, err := w.scalarFile(v)
+		if err == nil && !raw && (strings.HasSuffix(path, "@") || typeSuffix(path) != "") {
+			// Escape the name by writing the value as raw JSON
+			raw = true
+			data, err = json.Marshal(v)
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot unpack %s: %v", path, err)
+		}
+		return w.unpackFile(path, data, raw)
+	}
+
+	w.log.Print("unpacked ", path)
+	return path, nil
+}
+
+// checkUnpackFile returns an error if Walk wouldn't read the file at path, or would read it as an
+// ignore file. isDir is whether path is unpacked as a directory.
+func (w *walker) checkUnpackFile(path string, isDir bool) error {
+	if w.ignoreFile(path, isDir, nil) {
+		return errors.New("file would be ignored")
+	}
+	if !w.includeFile(path, isDir) {
+		return errors.New("file wouldn't be included")
+	}
+	for _, name := range w.IgnoreFiles {
+		if filepath.Base(path) == name {
+			return errors.New("file would be read as an ignore file")
+		}
+	}
+	return nil
+}
+
+// unpackFile writes data to a new file at path. If raw is true, an '@' is appended to path, after
+// a ".yaml" suffix if path already ends in a raw format suffix that Walk would otherwise trim.
+func (w *walker) unpackFile(path string, data []byte, raw bool) (string, error) {
+	if raw && rawFormat(path+"@") != "" {
+		path += ".yaml"
+	}
+	if raw {
+		path += "@"
+	}
+
+	if w.MaxSize > 0 && int64(len(data)) > w.MaxSize {
+		return "", fmt.Errorf("cannot unpack %s: larger than %d bytes", path, w.MaxSize)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	w.log.Print("unpacked ", path)
+	return path, nil
+}
+
+func checkUnpackKey(k string) error {
+	switch {
+	case k == "", k == ".", k == "..":
+		return errors.New("not a valid file name")
+	case strings.IndexByte(k, os.PathSeparator) != -1 || strings.IndexByte(k, '/') != -1:
+		return errors.New("contains a path separator")
+	case strings.IndexByte(k, 0) != -1:
+		return errors.New("contains a NUL byte")
+	}
+	return nil
+}
+
+// scalarFile returns the file contents for a scalar value. If the value wouldn't be read back as
+// itself by parseScalar, the contents are raw JSON and raw is true.
+func (w *walker) scalarFile(v interface{}) (data []byte, raw bool, err error) {
+	var text string
+	switch v := v.(type) {
+	case nil:
+		text = "null"
+	case bool:
+		text = strconv.FormatBool(v)
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		text = strconv.FormatFloat(v, 'g', -1, 64)
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return nil, false, fmt.Errorf("unsupported value of type %T", v)
+	}
+
+	want, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Walk would convert CRLF line endings in a plain file, but not in raw JSON.
+	if w.NormalizeNewlines && strings.Contains(text, "\r\n") {
+		return want, true, nil
+	}
+
+	if got, err := json.Marshal(w.parseScalar([]byte(text))); err == nil && bytes.Equal(got, want) {
+		return []byte(text), false, nil
+	}
+
+	return want, true, nil
+}
@@ -0,0 +1,85 @@
+package jsondir
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnpackRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		opts Options
+	}{
+		{"scalars", `{"s":"text","i":1,"f":1.5,"t":true,"n":null,"zip":"007","str":"true","ws":" x "}`, Options{}},
+		{"nested", `{"a":{"b":[1,{"c":"d"},[]],"e":{}},"list":["x","y"]}`, Options{}},
+		{"suffixes", `{"k@":1,"k!":{"x":1},"k[]":{"y":2},"k{}":{},"k.int":"1","k.str":"s"}`, Options{}},
+		{"raw formats", `{"x.yaml":"true","y.toml":"1","z.yml":[],"w.toml@":"a","v.yaml":"plain"}`, Options{}},
+		{"base64", `{"k.b64":"aGk=","k.b64@":"x","d.b64":{"e.b64":"y"}}`, Options{}},
+		{"raw format dirs", `{"d.yaml":{"e.toml":"2"},"a.yml":["007"]}`, Options{}},
+		{"array root", `[1,"two",{"three":3}]`, Options{}},
+		{"default array", `{"obj":{"a":1},"ary":[1,2]}`, Options{DefaultArray: true}},
+		{"crlf", `{"a":"x\r\ny","b":"x\ny"}`, Options{NormalizeNewlines: true}},
+		{"keywords", `{"a":true,"b":"1","c":1}`, Options{TrueTokens: []string{"1"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(c.in), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := Unpack(filepath.Join(t.TempDir(), "out"), v, c.opts)
+			if err != nil {
+				t.Fatalf("Unpack() = %v", err)
+			}
+
+			if got, want := walkJSON(t, path, c.opts), toJSON(t, v); got != want {
+				t.Errorf("Walk(Unpack(%s)) = %s", want, got)
+			}
+		})
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		v    interface{}
+		opts Options
+	}{
+		{"raw keys", map[string]interface{}{"a": "b"}, Options{RawKeys: true}},
+		{"key case", map[string]interface{}{"a": "b"}, Options{KeyCase: KeyCaseCamel}},
+		{"strip ext", map[string]interface{}{"a": "b"}, Options{StripExt: true}},
+		{"strip exts", map[string]interface{}{"a": "b"}, Options{StripExts: []string{".json"}}},
+		{"key map", map[string]interface{}{"a": "b"}, Options{KeyMap: []string{"a=b"}}},
+		{"dot keys", map[string]interface{}{"a": "b"}, Options{DotKeys: true}},
+		{"gzip", map[string]interface{}{"a": "b"}, Options{Gzip: true}},
+		{"meta", map[string]interface{}{"a": "b"}, Options{Meta: true}},
+		{"execute", map[string]interface{}{"a": "b"}, Options{AllowExecute: true}},
+		{"ignored", map[string]interface{}{"a.tmp": "b"}, Options{IgnorePatterns: []string{"*.tmp"}}},
+		{"not included", map[string]interface{}{"a": "b"}, Options{IncludePatterns: []string{"*.json"}}},
+		{"ignore file", map[string]interface{}{".gitignore": "*"}, Options{IgnoreFiles: []string{".gitignore"}}},
+		{"max size", map[string]interface{}{"a": "bcd"}, Options{MaxSize: 2}},
+		{"empty key", map[string]interface{}{"": "b"}, Options{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := Unpack(filepath.Join(t.TempDir(), "out"), c.v, c.opts); err == nil {
+				t.Error("Unpack() = nil; want an error")
+			}
+		})
+	}
+}
+
+func TestUnpackNoOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	if _, err := Unpack(path, map[string]interface{}{"a": "b"}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unpack(path, map[string]interface{}{"a": "b"}, Options{}); err == nil {
+		t.Fatal("Unpack() over an existing directory succeeded")
+	}
+}
@@ -0,0 +1,1277 @@
+package jsondir
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+func (w *walker) follow(loc string) error {
+	if w.FollowSymlinks {
+		return nil
+	}
+
+	ls, err := w.fs.Lstat(loc)
+	if err != nil {
+		return err
+	}
+
+	if ls.Mode()&os.ModeSymlink == os.ModeSymlink {
+		if !w.FollowFileSymlinks {
+			return w.skipSymlink(SkipFile(loc + " (symlink)"))
+		}
+		// Errors are left to the caller, which stats the symlink's target anyway.
+		if target, err := w.fs.Stat(loc); err == nil && target.IsDir() {
+			return w.skipSymlink(SkipFile(loc + " (symlink to directory)"))
+		}
+	}
+
+	return nil
+}
+
+// errSymlinkValue is returned by follow for symlinks that are represented by symlinkValue instead
+// of being skipped.
+var errSymlinkValue = errors.New("symlink isn't followed")
+
+// skipSymlink returns the error for a symlink that isn't followed: errSymlinkValue if SymlinkMeta
+// is set, or skip.
+func (w *walker) skipSymlink(skip SkipFile) error {
+	if w.SymlinkMeta {
+		return errSymlinkValue
+	}
+	return w.strict(skip)
+}
+
+// symlinkValue converts the symlink at loc, in the directory parent, to an object describing it.
+func (w *walker) symlinkValue(loc string, parent *dirFrame) (interface{}, error) {
+	if w.DryRun != nil {
+		w.dryRun(loc, parent, "object (symlink)")
+		return nil, nil
+	}
+
+	target, err := w.fs.ReadLink(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := "other"
+	switch fi, err := w.fs.Stat(loc); {
+	case err != nil:
+		kind = "missing"
+	case fi.IsDir():
+		kind = "dir"
+	case fi.Mode().IsRegular():
+		kind = "file"
+	}
+	return map[string]interface{}{"$symlink": target, "$type": kind}, nil
+}
+
+// strict returns skip as a failure if Strict is set. Otherwise, it returns skip.
+func (w *walker) strict(skip SkipFile) error {
+	if w.Strict {
+		return fmt.Errorf("cannot skip file entry %s in strict mode", string(skip))
+	}
+	return skip
+}
+
+// dirFrame is a directory being walked, linked to the frame of the directory containing it.
+type dirFrame struct {
+	parent  *dirFrame
+	fi      os.FileInfo
+	depth   int
+	ignores []ignoreRule // Rules from ignore files in this directory and its ancestors
+}
+
+// depthOf returns the depth of a file in the directory f. The root of a walk has no parent frame
+// and is at depth 0.
+func (f *dirFrame) depthOf() int {
+	if f == nil {
+		return 0
+	}
+	return f.depth + 1
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark, U+FEFF.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// walkValue converts the file at loc, in the directory parent, to a value.
+func (w *walker) walkValue(fi os.FileInfo, loc string, parent *dirFrame) (result interface{}, err error) {
+	if err = w.follow(loc); err == errSymlinkValue {
+		return w.symlinkValue(loc, parent)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Entries from a directory describe symlinks, not their targets.
+	if fi == nil || fi.Mode()&os.ModeSymlink != 0 {
+		fi, err = w.fs.Stat(loc)
+		if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ELOOP {
+			return nil, w.strict(SkipFile(loc + " (cycle detected)"))
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var data []byte
+	name := fi.Name()
+	gzipped := w.gzipName(name) != name
+	switch {
+	case fi.IsDir():
+		return w.walkDir(fi, loc, parent)
+	case w.AllowExecute && w.fs == osFS{} && w.isExecutable(fi):
+		gzipped = false
+		if w.DryRun != nil {
+			w.dryRun(loc, parent, "exec")
+			return nil, nil
+		}
+		data, err = w.execute(fi, loc, parent.depthOf())
+		if err != nil && !IsSkip(err) && err != context.Canceled {
+			w.errlog.Print("error executing ", loc, ": ", err)
+		}
+		if err == nil && w.MaxSize > 0 && int64(len(data)) > w.MaxSize {
+			if w.Oversize != OversizeTruncate {
+				return nil, w.oversize(loc, "output")
+			}
+			data = data[:w.MaxSize]
+		}
+		if w.ExecJSON {
+			// Read the output as raw JSON, as if the executable's name ended in an '@'.
+			name += "@"
+		}
+	case w.MaxSize > 0 && fi.Size() > w.MaxSize && w.Oversize != OversizeTruncate:
+		return nil, w.oversize(loc, fmt.Sprintf("%d bytes", fi.Size()))
+	case w.DryRun != nil && hintKind(name) != "":
+		w.dryRun(loc, parent, hintKind(name))
+		return nil, nil
+	case w.MaxSize > 0 && fi.Size() > w.MaxSize && !gzipped:
+		data, err = w.readFileN(loc, w.MaxSize)
+	default:
+		data, err = w.fs.ReadFile(loc)
+	}
+
+	if err == nil && gzipped {
+		data, err = w.gunzip(loc, data)
+		name = w.gzipName(name)
+	}
+	for err == nil && strings.HasSuffix(name, "@") && rawFormat(name) == ".b64" {
+		data, err = decodeBase64(data)
+		name = strings.TrimSuffix(name, ".b64@")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Binary != BinaryString && !strings.HasSuffix(name, "@") && typeSuffix(name) == "" && isBinary(data) {
+		switch w.Binary {
+		case BinaryBase64:
+			name += ".b64"
+		case BinarySkip:
+			return nil, SkipFile(loc + " (binary)")
+		case BinaryError:
+			return nil, errors.New("contents are binary")
+		}
+	}
+
+	// Some editors start text files with a byte order mark, which would otherwise defeat type
+	// inference and JSON decoding. Base64-encoded files are binary, so they keep it.
+	if typeSuffix(name) != ".b64" {
+		data = bytes.TrimPrefix(data, utf8BOM)
+		if w.NormalizeNewlines && !strings.HasSuffix(name, "@") {
+			data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		}
+	}
+
+	if w.Empty == EmptySkip && !strings.HasSuffix(name, "@") && typeSuffix(name) == "" && w.isEmpty(data) {
+		return nil, SkipFile(loc + " (empty)")
+	}
+
+	if w.DryRun != nil {
+		w.dryRunFile(loc, parent, name, data)
+		return nil, nil
+	}
+
+	if result, err = w.fileValue(name, data); err != nil || !w.Meta {
+		return result, err
+	}
+
+	meta := fileMeta(fi)
+	meta["value"] = result
+	return meta, nil
+}
+
+// oversize returns the error for the file at loc, whose size or output is larger than MaxSize, if
+// Oversize isn't OversizeTruncate. what describes its size.
+func (w *walker) oversize(loc, what string) error {
+	if w.Oversize == OversizeError {
+		return fmt.Errorf("%s is larger than the maximum size of %d bytes", what, w.MaxSize)
+	}
+	return w.strict(SkipFile(fmt.Sprintf("%s (%s is larger than the maximum size)", loc, what)))
+}
+
+// gzipName returns name without a ".gz" suffix if Gzip is set. Otherwise, it returns name.
+func (w *walker) gzipName(name string) string {
+	if !w.Gzip {
+		return name
+	}
+	return strings.TrimSuffix(name, ".gz")
+}
+
+// gunzip returns the decompressed contents of the gzip data of the file at loc. If MaxSize is set,
+// decompressed contents larger than it are handled according to Oversize.
+func (w *walker) gunzip(loc string, data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip data: %v", err)
+	}
+
+	var r io.Reader = zr
+	if w.MaxSize > 0 {
+		r = io.LimitReader(zr, w.MaxSize+1)
+	}
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip data: %v", err)
+	}
+
+	if w.MaxSize > 0 && int64(len(data)) > w.MaxSize {
+		if w.Oversize != OversizeTruncate {
+			return nil, w.oversize(loc, "decompressed contents")
+		}
+		data = data[:w.MaxSize]
+	}
+	return data, nil
+}
+
+// decodeBase64 decodes the standard base64 encoding in data, ignoring whitespace and padding.
+func decodeBase64(data []byte) ([]byte, error) {
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(data))
+
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+	return data, nil
+}
+
+// readFileN reads at most n bytes from the start of the file at loc.
+func (w *walker) readFileN(loc string, n int64) ([]byte, error) {
+	f, err := w.fs.Open(loc)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(io.LimitReader(f, n))
+}
+
+// fileValue converts the contents of the file name to a value.
+func (w *walker) fileValue(name string, data []byte) (interface{}, error) {
+	if interpolated := strings.HasSuffix(name, "@"); interpolated {
+		switch rawFormat(name) {
+		case ".yaml", ".yml":
+			return decodeYAML(data)
+		case ".toml":
+			return decodeTOML(data)
+		}
+		// Have to unmarshal this instead of returning RawMessage to handle merging paths.
+		return w.unmarshal(data)
+	}
+
+	if hint := typeSuffix(name); hint != "" {
+		return w.parseHinted(hint, data)
+	}
+
+	return w.parseScalar(data), nil
+}
+
+// isBinary returns whether the contents of a file are binary: not valid UTF-8, or containing a NUL
+// byte.
+func isBinary(data []byte) bool {
+	return !utf8.Valid(data) || bytes.IndexByte(data, 0) != -1
+}
+
+// isEmpty returns whether the contents of a file are empty. Unless KeepWhitespace is set, contents
+// with only whitespace are empty.
+func (w *walker) isEmpty(data []byte) bool {
+	if w.KeepWhitespace {
+		return len(data) == 0
+	}
+	return len(bytes.TrimRightFunc(data, unicode.IsSpace)) == 0
+}
+
+// fileMeta returns the metadata of a file for Options.Meta.
+func fileMeta(fi os.FileInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"mode":  fmt.Sprintf("%04o", fi.Mode().Perm()),
+		"size":  fi.Size(),
+		"mtime": fi.ModTime().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// unmarshal decodes a raw JSON value. If UseNumber is set, numbers are decoded as json.Number.
+func (w *walker) unmarshal(data []byte) (result interface{}, err error) {
+	if !w.UseNumber {
+		err = json.Unmarshal(data, &result)
+		return result, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+
+	return result, nil
+}
+
+// typeSuffix returns the type hint suffix of a file name (e.g., ".int"), or the empty string if
+// it has none.
+func typeSuffix(name string) string {
+	switch ext := filepath.Ext(name); ext {
+	case ".str", ".int", ".hex", ".float", ".bool", ".null", ".lines", ".csv", ".b64", ".time", ".dur",
+		".env":
+		return ext
+	}
+	return ""
+}
+
+// parseHinted converts the contents of a file to the type named by its type hint suffix. Unlike
+// parseScalar, contents that aren't valid for the type are an error.
+func (w *walker) parseHinted(hint string, data []byte) (interface{}, error) {
+	if hint == ".b64" {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	dstr := string(data)
+	trimmed := w.trim(dstr)
+
+	switch hint {
+	case ".lines":
+		return w.parseLines(dstr), nil
+	case ".csv":
+		return w.parseCSV(data)
+	case ".env":
+		return w.parseEnv(dstr)
+	case ".str":
+		if w.KeepWhitespace {
+			return dstr, nil
+		}
+		return trimmed, nil
+	case ".int":
+		if i64, err := strconv.ParseInt(w.digits(trimmed), w.IntBase, 64); err == nil && w.underscoreOK(trimmed) {
+			return i64, nil
+		}
+	case ".hex":
+		if i64, ok := parseHex(strings.TrimSpace(trimmed)); ok && w.HexStrings {
+			return strings.TrimSpace(trimmed), nil
+		} else if ok {
+			return i64, nil
+		}
+	case ".float":
+		if f64, err := strconv.ParseFloat(trimmed, 64); err == nil && w.underscoreOK(trimmed) {
+			return f64, nil
+		}
+	case ".bool":
+		if v, ok := w.keyword(trimmed); ok && v != nil {
+			return v, nil
+		}
+	case ".null":
+		if v, ok := w.keyword(trimmed); trimmed == "" || ok && v == nil {
+			return nil, nil
+		}
+	case ".time":
+		if t, ok := w.parseTime(strings.TrimSpace(trimmed)); ok {
+			return t, nil
+		}
+	case ".dur":
+		if d, err := time.ParseDuration(strings.TrimSpace(trimmed)); err == nil && w.DurationUnit > 0 {
+			return int64(d / w.DurationUnit), nil
+		} else if err == nil {
+			return d.String(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot parse %q as %s", trimmed, hint[1:])
+}
+
+// parseLines converts each line of the contents of a .lines file to a scalar, as by parseScalar.
+// Trailing blank lines are dropped, as are empty lines if Empty is EmptySkip.
+func (w *walker) parseLines(dstr string) []interface{} {
+	lines := strings.Split(dstr, "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	values := make([]interface{}, 0, len(lines))
+	for _, line := range lines {
+		if w.Empty == EmptySkip && w.isEmpty([]byte(line)) {
+			continue
+		}
+		values = append(values, w.parseScalar([]byte(line)))
+	}
+	return values
+}
+
+// parseCSV converts the contents of a .csv file to an array of objects, one for each record after
+// the first. The first record holds the keys of each field, and fields are converted to scalars as
+// by parseScalar.
+func (w *walker) parseCSV(data []byte) ([]interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	if w.CSVDelimiter != 0 {
+		r.Comma = w.CSVDelimiter
+	}
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+
+	rows := make([]interface{}, 0, len(records))
+	for i := 1; i < len(records); i++ {
+		row := make(map[string]interface{}, len(records[0]))
+		for j, field := range records[i] {
+			row[records[0][j]] = w.parseScalar([]byte(field))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseEnv converts the KEY=VALUE lines of the contents of a .env file to an object. Blank lines
+// and comments are skipped, and an "export " prefix is ignored. Quoted values are unquoted and
+// always strings; other values are converted as by parseScalar, without any trailing comment.
+func (w *walker) parseEnv(dstr string) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	for i, line := range strings.Split(dstr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid env line %d: missing '='", i+1)
+		}
+		key := strings.TrimSpace(strings.TrimPrefix(line[:eq], "export "))
+		if key == "" {
+			return nil, fmt.Errorf("invalid env line %d: missing key", i+1)
+		}
+
+		value := strings.TrimSpace(line[eq+1:])
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			s, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid env line %d: %v", i+1, err)
+			}
+			obj[key] = s
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			obj[key] = value[1 : len(value)-1]
+		default:
+			if c := strings.Index(value, " #"); c >= 0 {
+				value = strings.TrimSpace(value[:c])
+			}
+			obj[key] = w.parseScalar([]byte(value))
+		}
+	}
+	return obj, nil
+}
+
+// trim returns s without trailing whitespace, or without leading and trailing whitespace if
+// TrimSpace is set.
+func (w *walker) trim(s string) string {
+	if w.TrimSpace {
+		return strings.TrimSpace(s)
+	}
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+// parseScalar converts the contents of a file to a JSON scalar. Type precedence is null, boolean,
+// integer, float, time (if ParseTime is set), and then string as a catch-all. Numbers with a
+// leading zero are strings unless AutoBase or IntBase is set, and integers with digits outside
+// IntBase are strings. If RawStrings is set, the contents are always a string. Empty contents are
+// null if Empty is EmptyNull.
+func (w *walker) parseScalar(data []byte) interface{} {
+	dstr := string(data)
+	trimmed := w.trim(dstr)
+	if !w.KeepWhitespace {
+		dstr = trimmed
+	}
+
+	if dstr == "" && w.Empty == EmptyNull {
+		return nil
+	}
+
+	if w.RawStrings {
+		return dstr
+	}
+
+	// Keywords come first so that tokens such as "1" can be configured as booleans.
+	if v, ok := w.keyword(dstr); ok {
+		return v
+	}
+
+	if w.UseNumber && isJSONNumber(trimmed) {
+		return json.Number(trimmed)
+	}
+
+	switch dstr {
+	case "0":
+		return int64(0)
+	}
+
+	// Numbers with a leading zero are strings, but they may still be times, such as "09:30:00".
+	if (w.IntBase != 0 || w.AutoBase || !hasLeadingZero(trimmed)) && w.underscoreOK(trimmed) {
+		i64, err := strconv.ParseInt(w.digits(trimmed), w.IntBase, 64)
+		if err == nil {
+			if w.HexStrings && w.IntBase == 0 && isHexPrefixed(trimmed) {
+				return dstr
+			}
+			return i64
+		}
+
+		// An integer with digits outside IntBase, such as "0755" in base 2, isn't a float.
+		outsideBase := w.IntBase != 0 && errors.Is(err, strconv.ErrSyntax) && isDecimal(trimmed)
+		if f64, err := strconv.ParseFloat(trimmed, 64); err == nil && !outsideBase {
+			return f64
+		}
+	}
+
+	if w.ParseTime {
+		if t, ok := w.parseTime(trimmed); ok {
+			return t
+		}
+	}
+
+	return dstr
+}
+
+// Default tokens for null, true, and false, used when the corresponding Options field is nil.
+var (
+	DefaultNullTokens  = []string{"null", "NULL"}
+	DefaultTrueTokens  = []string{"true", "TRUE"}
+	DefaultFalseTokens = []string{"false", "FALSE"}
+)
+
+// keyword returns the value of s if it's one of NullTokens, TrueTokens, or FalseTokens, checked in
+// that order, and whether it is.
+func (w *walker) keyword(s string) (interface{}, bool) {
+	tokens := []struct {
+		list, defaults []string
+		value          interface{}
+	}{
+		{w.NullTokens, DefaultNullTokens, nil},
+		{w.TrueTokens, DefaultTrueTokens, true},
+		{w.FalseTokens, DefaultFalseTokens, false},
+	}
+	for _, t := range tokens {
+		list := t.list
+		if list == nil {
+			list = t.defaults
+		}
+		for _, tok := range list {
+			if s == tok {
+				return t.value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// DefaultTimeLayouts are the layouts of times parsed from files when Options.TimeLayouts is empty.
+var DefaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseTime parses s using TimeLayouts, or DefaultTimeLayouts if there are none, and returns it
+// as an RFC 3339 time in UTC.
+func (w *walker) parseTime(s string) (string, bool) {
+	layouts := w.TimeLayouts
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format(time.RFC3339Nano), true
+		}
+	}
+	return "", false
+}
+
+// underscoreOK returns whether s may be read as a number with regard to underscores: if it has
+// any, NumUnderscore must be set. Whether they're between digits is left to the parser.
+func (w *walker) underscoreOK(s string) bool {
+	return w.NumUnderscore || !strings.Contains(s, "_")
+}
+
+// digits returns s without the underscores between its digits if NumUnderscore and IntBase are set
+// and every underscore is between two digits in IntBase. Otherwise, it returns s.
+func (w *walker) digits(s string) string {
+	if !w.NumUnderscore || w.IntBase == 0 || !strings.Contains(s, "_") {
+		return s
+	}
+	isDigit := func(i int) bool {
+		if i < 0 || i >= len(s) {
+			return false
+		}
+		d, err := strconv.ParseUint(s[i:i+1], w.IntBase, 8)
+		return err == nil && d < uint64(w.IntBase)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' && !(isDigit(i-1) && isDigit(i+1)) {
+			return s
+		}
+	}
+	return strings.Replace(s, "_", "", -1)
+}
+
+// parseHex parses s, which may have a sign and a "0x" prefix, as a hexadecimal int64. Leading
+// zeros are allowed, and underscores aren't.
+func parseHex(s string) (int64, bool) {
+	sign := ""
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	if isHexPrefixed(s) {
+		s = s[2:]
+	}
+	if s == "" || strings.ContainsAny(s, "+-_") {
+		return 0, false
+	}
+	i64, err := strconv.ParseInt(sign+s, 16, 64)
+	return i64, err == nil
+}
+
+// isHexPrefixed returns whether s, ignoring its sign, begins with "0x" or "0X".
+func isHexPrefixed(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	return len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+}
+
+// hasLeadingZero returns whether s, ignoring its sign, begins with a zero followed by another digit
+// or a base prefix (as in "0755" or "0x1F").
+func hasLeadingZero(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+
+	if len(s) < 2 || s[0] != '0' {
+		return false
+	}
+
+	switch c := s[1]; {
+	case c >= '0' && c <= '9', c == '_':
+		return true
+	case c == 'x', c == 'X', c == 'o', c == 'O', c == 'b', c == 'B':
+		return true
+	}
+	return false
+}
+
+// isDecimal returns whether s, ignoring its sign, is a non-empty run of decimal digits.
+func isDecimal(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isJSONNumber returns whether s is a valid JSON number.
+func isJSONNumber(s string) bool {
+	return s != "" && (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s))
+}
+
+// dirEntry is an entry in a directory being walked.
+type dirEntry struct {
+	path  string
+	fi    os.FileInfo
+	key   string
+	value interface{}
+	err   error
+}
+
+// dirListing is the entries of a directory to walk.
+type dirListing struct {
+	frame    *dirFrame
+	entries  []dirEntry
+	isArray  bool
+	isScalar bool // Whether the directory's value is that of its only entry
+}
+
+// listDir returns the entries of the directory fi at loc, in the directory parent, in the order
+// they're walked. If the directory's value doesn't depend on its entries, such as when it's beyond
+// MaxDepth, it returns a nil listing and that value instead.
+func (w *walker) listDir(fi os.FileInfo, loc string, parent *dirFrame) (l *dirListing, value interface{}, err error) {
+	isScalar := strings.HasSuffix(loc, "!")
+	isArray := strings.HasSuffix(loc, "[]") ||
+		w.DefaultArray && !isScalar && !strings.HasSuffix(loc, "{}")
+
+	key := loc
+	if strings.HasSuffix(loc, "[]") || strings.HasSuffix(loc, "{}") {
+		key = key[:len(key)-2]
+	} else if isScalar {
+		key = key[:len(key)-1]
+	}
+
+	if key == "" {
+		if w.Strict {
+			return nil, nil, w.strict(SkipFile(loc + " (invalid name)"))
+		}
+		w.errlog.Print("skipping invalid file ", loc)
+		return nil, nil, SkipFile(loc)
+	}
+
+	frame := &dirFrame{parent: parent, fi: fi, depth: parent.depthOf()}
+	if w.FollowSymlinks {
+		for up := parent; up != nil; up = up.parent {
+			if os.SameFile(fi, up.fi) {
+				return nil, nil, w.strict(SkipFile(loc + " (cycle detected)"))
+			}
+		}
+	}
+
+	if w.MaxDepth > 0 && frame.depth >= w.MaxDepth {
+		switch w.BeyondDepth {
+		case DepthNull:
+			return nil, nil, nil
+		case DepthEmpty:
+			if isArray {
+				return nil, []interface{}{}, nil
+			}
+			return nil, map[string]interface{}{}, nil
+		default:
+			return nil, nil, SkipFile(loc + " (beyond max depth)")
+		}
+	}
+
+	if frame.ignores, err = w.readIgnoreFiles(loc, parent); err != nil {
+		return nil, nil, err
+	}
+
+	if w.DryRun != nil && isArray {
+		w.dryRun(loc, parent, "array")
+	} else if w.DryRun != nil && isScalar {
+		w.dryRun(loc, parent, "value")
+	} else if w.DryRun != nil {
+		w.dryRun(loc, parent, "object")
+	}
+
+	info, err := w.fs.ReadDir(loc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]dirEntry, 0, len(info))
+	for _, fi := range info {
+		path := filepath.Join(loc, fi.Name())
+		isDir := w.isDir(path, fi)
+		if w.ignoreFile(path, isDir, frame) || !w.includeFile(path, isDir) {
+			continue
+		}
+
+		e := dirEntry{path: path, fi: fi}
+		if !isArray {
+			if e.key = w.entryKey(fi); e.key == "" {
+				if w.Strict {
+					return nil, nil, w.strict(SkipFile(path + " (invalid name)"))
+				}
+				w.log.Print(SkipFile(path))
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	if isArray && !sortNumeric(entries) && w.NaturalSort {
+		sortNatural(entries)
+	}
+	return &dirListing{frame: frame, entries: entries, isArray: isArray, isScalar: isScalar}, nil, nil
+}
+
+func (w *walker) walkDir(fi os.FileInfo, loc string, parent *dirFrame) (result interface{}, err error) {
+	l, value, err := w.listDir(fi, loc, parent)
+	if l == nil || err != nil {
+		return value, err
+	}
+	entries, isArray, isScalar := l.entries, l.isArray, l.isScalar
+
+	w.walkEntries(entries, l.frame)
+
+	var ary []interface{}
+	obj := make(map[string]interface{})
+	paths := make(map[string]string) // The path of each key in obj
+	canceled := false
+	for _, e := range entries {
+		switch {
+		case e.err == context.Canceled:
+			// Another entry failed -- keep looking for it in case it's in this directory.
+			canceled = true
+			continue
+		case IsSkip(e.err):
+			w.log.Print(e.err)
+			continue
+		case e.err != nil && w.KeepGoing:
+			w.addError(e.path, e.err)
+			continue
+		case e.err != nil:
+			w.errlog.Print("unable to load file at path ", e.path, ": ", e.err)
+			return nil, e.err
+		}
+
+		if isArray {
+			w.addSource(e.path, loc, strconv.Itoa(len(ary)))
+			ary = append(ary, e.value)
+			continue
+		} else if isScalar {
+			// The value of the directory is the value of its only entry.
+			w.addSource(e.path, loc)
+			ary = append(ary, e.value)
+			continue
+		}
+
+		if prev, ok := paths[e.key]; ok {
+			// Entries are in lexical order, so prev sorts first.
+			err := fmt.Errorf("duplicate key %q from %s and %s", e.key, prev, e.path)
+			switch {
+			case w.Strict || w.Duplicates == DuplicateError:
+				return nil, err
+			case w.Duplicates == DuplicateFirst:
+				w.errlog.Print(err, ": using ", prev)
+				continue
+			}
+			w.errlog.Print(err, ": using ", e.path)
+		}
+		paths[e.key] = e.path
+		obj[e.key] = e.value
+	}
+
+	if w.DotKeys {
+		if obj, err = w.nestKeys(obj, paths); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, path := range paths {
+		w.addSource(path, loc, w.splitKey(key)...)
+	}
+
+	switch {
+	case canceled:
+		return nil, context.Canceled
+	case isScalar && len(ary) != 1:
+		return nil, fmt.Errorf("%s must contain exactly one file, found %d", loc, len(ary))
+	case isScalar:
+		return ary[0], nil
+	case len(w.includes) > 0 && parent != nil && len(ary) == 0 && len(obj) == 0:
+		// Prune directories without any included files, other than the root.
+		return nil, SkipFile(loc + " (no included files)")
+	case len(ary) == 0 && len(obj) == 0 && w.EmptyDir != EmptyDirKeep:
+		return w.emptyDir(loc)
+	case isArray:
+		return ary, nil
+	}
+
+	if _, ok := obj["_meta"]; w.Meta && !ok {
+		obj["_meta"] = fileMeta(fi)
+	}
+	return obj, nil
+}
+
+// splitKey returns the keys of the objects that key is nested in, followed by its own key, if
+// DotKeys is set. key is split at each '.' that isn't escaped as "\.". Keys with an empty part,
+// such as ".env" or "a..b", aren't split, but their escaped dots are still unescaped.
+func (w *walker) splitKey(key string) []string {
+	if !w.DotKeys || !strings.Contains(key, ".") {
+		return []string{key}
+	}
+
+	var parts []string
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			sb.WriteByte('.')
+			i++
+		case key[i] == '.':
+			parts = append(parts, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(key[i])
+		}
+	}
+	parts = append(parts, sb.String())
+
+	for _, part := range parts {
+		if part == "" {
+			return []string{strings.Replace(key, `\.`, ".", -1)}
+		}
+	}
+	return parts
+}
+
+// nestKeys returns obj with each of its keys split by splitKey and nested in objects, merged with
+// any objects already at those keys. It's a failure for a key to be nested in a value that isn't
+// an object, or for two files to have the same nested key. paths holds the path of each key in
+// obj.
+func (w *walker) nestKeys(obj map[string]interface{}, paths map[string]string) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	nested := make(map[string]interface{}, len(obj))
+	for _, key := range keys {
+		conflict := fmt.Errorf("key %q from %s conflicts with another value", key, paths[key])
+		parts := w.splitKey(key)
+		dst := nested
+		for _, part := range parts[:len(parts)-1] {
+			v, ok := dst[part]
+			if !ok {
+				v = make(map[string]interface{})
+				dst[part] = v
+			}
+			if dst, ok = v.(map[string]interface{}); !ok {
+				return nil, conflict
+			}
+		}
+		if !mergeKey(dst, parts[len(parts)-1], obj[key]) {
+			return nil, conflict
+		}
+	}
+	return nested, nil
+}
+
+// mergeKey sets key in dst to v, merging their keys if both v and the value already at key are
+// objects. It returns false if they conflict.
+func mergeKey(dst map[string]interface{}, key string, v interface{}) bool {
+	prev, ok := dst[key]
+	if !ok {
+		dst[key] = v
+		return true
+	}
+
+	prevObj, ok := prev.(map[string]interface{})
+	obj, isObj := v.(map[string]interface{})
+	if !ok || !isObj {
+		return false
+	}
+	for k, v := range obj {
+		if !mergeKey(prevObj, k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// emptyDir returns the value of the empty directory at loc according to EmptyDir.
+func (w *walker) emptyDir(loc string) (interface{}, error) {
+	switch w.EmptyDir {
+	case EmptyDirObject:
+		return map[string]interface{}{}, nil
+	case EmptyDirArray:
+		return []interface{}{}, nil
+	case EmptyDirNull:
+		return nil, nil
+	default:
+		return nil, SkipFile(loc + " (empty directory)")
+	}
+}
+
+// sortNumeric sorts entries by the integer value of their names, with suffixes trimmed, if all of
+// them are integers, and returns true. Otherwise, entries are left in lexical order.
+func sortNumeric(entries []dirEntry) bool {
+	nums := make([]int64, len(entries))
+	for i, e := range entries {
+		n, err := strconv.ParseInt(objectKey(e.fi), 10, 64)
+		if err != nil {
+			return false
+		}
+		nums[i] = n
+	}
+
+	sort.Stable(numericEntries{entries, nums})
+	return true
+}
+
+// sortNatural sorts entries by their names, with suffixes trimmed, comparing runs of digits by
+// their integer value so that "item2" comes before "item10".
+func sortNatural(entries []dirEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return naturalLess(objectKey(entries[i].fi), objectKey(entries[j].fi))
+	})
+}
+
+// naturalLess returns whether a comes before b in natural order.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da == "" || db == "" {
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// Compare digit runs by length without leading zeros, then lexically.
+		na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+		if len(na) != len(nb) {
+			return len(na) < len(nb)
+		} else if na != nb {
+			return na < nb
+		}
+		a, b = a[len(da):], b[len(db):]
+	}
+	return len(a) < len(b)
+}
+
+// digitPrefix returns the leading ASCII digits of s.
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+type numericEntries struct {
+	entries []dirEntry
+	nums    []int64
+}
+
+func (n numericEntries) Len() int           { return len(n.entries) }
+func (n numericEntries) Less(i, j int) bool { return n.nums[i] < n.nums[j] }
+func (n numericEntries) Swap(i, j int) {
+	n.entries[i], n.entries[j] = n.entries[j], n.entries[i]
+	n.nums[i], n.nums[j] = n.nums[j], n.nums[i]
+}
+
+// rawFormat returns the suffix of the format of the raw file name, ending in an '@', if it's
+// ".yaml", ".yml", ".toml", or ".b64". Otherwise, the file is JSON and rawFormat returns the empty
+// string.
+func rawFormat(name string) string {
+	switch ext := filepath.Ext(strings.TrimSuffix(name, "@")); ext {
+	case ".yaml", ".yml", ".toml", ".b64":
+		return ext
+	}
+	return ""
+}
+
+// objectKey returns the key for a directory entry in an object.
+func objectKey(fi os.FileInfo) string {
+	return nameKey(fi.Name(), fi.IsDir())
+}
+
+// nameKey returns the key for a file or directory named name in an object.
+func nameKey(name string, isDir bool) string {
+	key := name
+	switch {
+	case strings.HasSuffix(key, "@"): // Interpolated value
+		key = key[:len(key)-1]
+		if !isDir && rawFormat(key+"@") == ".b64" {
+			// The decoded contents are read as if the file were named without ".b64@".
+			return nameKey(strings.TrimSuffix(key, ".b64"), false)
+		} else if !isDir {
+			key = strings.TrimSuffix(key, rawFormat(key+"@"))
+		}
+	case !isDir && typeSuffix(key) != "": // Type hint
+		key = strings.TrimSuffix(key, typeSuffix(key))
+	case isDir && strings.HasSuffix(key, "[]"): // Array
+		key = key[:len(key)-2]
+	case isDir && strings.HasSuffix(key, "{}"): // Forced obj (e.g., if key ends in [])
+		key = key[:len(key)-2]
+	case isDir && strings.HasSuffix(key, "!"): // Value of its only entry
+		key = key[:len(key)-1]
+	}
+	return key
+}
+
+// keyRule is a rule of KeyMap.
+type keyRule struct {
+	pattern string // The filepath.Match pattern of the file names it applies to
+	key     string // The key of those files
+}
+
+// entryKey returns the key of the file described by fi in an object: the key of the first rule of
+// KeyMap that matches its name, if any, its name if RawKeys is set, or objectKey(fi) without any
+// ".gz" trimmed by Gzip or extension trimmed by StripExt or StripExts and converted to KeyCase
+// otherwise.
+func (w *walker) entryKey(fi os.FileInfo) string {
+	for _, rule := range w.keyMap {
+		if ok, _ := filepath.Match(rule.pattern, fi.Name()); ok {
+			return rule.key
+		}
+	}
+
+	if w.RawKeys {
+		return fi.Name()
+	}
+
+	if fi.IsDir() {
+		return w.caseKey(objectKey(fi))
+	}
+	return w.caseKey(w.stripExt(nameKey(w.gzipName(fi.Name()), false)))
+}
+
+// stripExt returns key without its extension if it's trimmed by StripExt or StripExts.
+func (w *walker) stripExt(key string) string {
+	ext := filepath.Ext(key)
+	if ext == "" || ext == key {
+		return key
+	}
+	for _, strip := range w.StripExts {
+		if ext == strip {
+			return key[:len(key)-len(ext)]
+		}
+	}
+	if w.StripExt {
+		return key[:len(key)-len(ext)]
+	}
+	return key
+}
+
+// caseKey returns key converted to KeyCase. Each part of key between dots is converted on its own,
+// so that the parts split by DotKeys are kept.
+func (w *walker) caseKey(key string) string {
+	switch w.KeyCase {
+	case KeyCaseLower:
+		return strings.ToLower(key)
+	case KeyCaseUpper:
+		return strings.ToUpper(key)
+	case KeyCaseKeep:
+		return key
+	}
+
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		words := keyWords(part)
+		for j, word := range words {
+			word = strings.ToLower(word)
+			if w.KeyCase == KeyCaseCamel && j > 0 {
+				r, size := utf8.DecodeRuneInString(word)
+				word = string(unicode.ToUpper(r)) + word[size:]
+			}
+			words[j] = word
+		}
+
+		switch w.KeyCase {
+		case KeyCaseCamel:
+			parts[i] = strings.Join(words, "")
+		case KeyCaseSnake:
+			parts[i] = strings.Join(words, "_")
+		case KeyCaseKebab:
+			parts[i] = strings.Join(words, "-")
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// keyWords splits key into words at each '-', '_', or space, and where a lowercase letter or
+// digit is followed by an uppercase letter or an uppercase letter starts a capitalized word after
+// others, so that "max-retries", "max_retries", and "maxRetries" are all "max" and "retries", and
+// "HTTPServer" is "HTTP" and "Server".
+func keyWords(key string) []string {
+	var words []string
+	runes := []rune(key)
+	start := 0
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == '_' || r == ' ':
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// walkEntries walks the values of entries in the directory dir, storing each entry's result in it.
+// Up to Jobs entries are walked concurrently. Unless KeepGoing is set, if walking an entry fails
+// with an error other than SkipFile, the walk is canceled and any entries that haven't started yet
+// fail with context.Canceled, as they do if the walk's context is done.
+func (w *walker) walkEntries(entries []dirEntry, dir *dirFrame) {
+	var wg sync.WaitGroup
+	for i := range entries {
+		e := &entries[i]
+		walk := func() {
+			if w.ctx.Err() != nil {
+				e.err = context.Canceled
+				return
+			}
+
+			e.value, e.err = w.walkValue(e.fi, e.path, dir)
+			if e.err != nil && !IsSkip(e.err) && e.err != context.Canceled && !w.KeepGoing {
+				w.cancel()
+			}
+		}
+
+		// Only hand entries off to another goroutine if there's a free job -- otherwise, walk
+		// them on this one so that nested directories can't exhaust the jobs and deadlock.
+		select {
+		case w.jobs <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-w.jobs }()
+				walk()
+			}()
+		default:
+			walk()
+		}
+	}
+	wg.Wait()
+}
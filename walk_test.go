@@ -0,0 +1,543 @@
+package jsondir
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalkDeterministic(t *testing.T) {
+	root := genTree(t, 8, 3)
+
+	var want []byte
+	for i, jobs := range []int{0, 1, 4, 16, 0, 16} {
+		v, err := Walk(root, Options{Jobs: jobs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.MarshalIndent(v, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			want = got
+		} else if !bytes.Equal(got, want) {
+			t.Fatalf("Walk() with Jobs = %d differs from the first walk", jobs)
+		}
+	}
+
+	// StreamEncode writes the same bytes as encoding/json, every time.
+	compact := new(bytes.Buffer)
+	if err := json.Compact(compact, want); err != nil {
+		t.Fatal(err)
+	}
+	compact.WriteByte('\n')
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		if err := StreamEncode(&buf, root, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), compact.Bytes()) {
+			t.Fatalf("StreamEncode() = %s; want %s", buf.Bytes(), compact.Bytes())
+		}
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	root := genTree(b, 32, 2)
+	for _, jobs := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Walk(root, Options{Jobs: jobs}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkMaxDepth(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"x":     "1",
+		"a/y":   "2",
+		"a/b/z": "3",
+	})
+
+	cases := []struct {
+		depth int
+		mode  DepthMode
+		want  string
+	}{
+		{-1, DepthOmit, `{"a":{"b":{"z":3},"y":2},"x":1}`},
+		{0, DepthOmit, `{"a":{"b":{"z":3},"y":2},"x":1}`},
+		{1, DepthOmit, `{"x":1}`},
+		{2, DepthOmit, `{"a":{"y":2},"x":1}`},
+		{3, DepthOmit, `{"a":{"b":{"z":3},"y":2},"x":1}`},
+		{1, DepthNull, `{"a":null,"x":1}`},
+		{2, DepthEmpty, `{"a":{"b":{},"y":2},"x":1}`},
+	}
+
+	for _, c := range cases {
+		opts := Options{MaxDepth: c.depth, BeyondDepth: c.mode}
+		if got := walkJSON(t, root, opts); got != c.want {
+			t.Errorf("Walk() with MaxDepth = %d = %s; want %s", c.depth, got, c.want)
+		}
+	}
+}
+
+// scalarJSON returns the JSON encoding of the value of a file containing s, as read by parseScalar
+// with opts.
+func scalarJSON(t *testing.T, opts Options, s string) string {
+	t.Helper()
+	w, err := newWalker(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.cancel()
+	return toJSON(t, w.parseScalar([]byte(s)))
+}
+
+type scalarCase struct {
+	in, want string
+}
+
+// testScalars checks that parseScalar reads each case's input as its wanted JSON value with opts.
+func testScalars(t *testing.T, opts Options, cases []scalarCase) {
+	t.Helper()
+	for _, c := range cases {
+		if got := scalarJSON(t, opts, c.in); got != c.want {
+			t.Errorf("parseScalar(%q) with %+v = %s; want %s", c.in, opts, got, c.want)
+		}
+	}
+}
+
+func TestLeadingZero(t *testing.T) {
+	testScalars(t, Options{}, []scalarCase{
+		{"0", `0`},
+		{"-0", `0`},
+		{"00", `"00"`},
+		{"0123", `"0123"`},
+		{"-0123", `"-0123"`},
+		{"0x10", `"0x10"`},
+		{"0b101", `"0b101"`},
+		{"0.5", `0.5`},
+		{"123", `123`},
+	})
+
+	testScalars(t, Options{AutoBase: true}, []scalarCase{
+		{"0", `0`},
+		{"-0", `0`},
+		{"00", `0`},
+		{"0123", `83`},
+		{"0x10", `16`},
+		{"0b101", `5`},
+		{"0.5", `0.5`},
+	})
+
+	root := writeTree(t, map[string]string{"zip": "01234\n", "zero": "0\n", "octal": "010\n"})
+	if got, want := walkJSON(t, root, Options{}), `{"octal":"010","zero":0,"zip":"01234"}`; got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+	if got, want := walkJSON(t, root, Options{AutoBase: true}), `{"octal":8,"zero":0,"zip":668}`; got != want {
+		t.Errorf("Walk() with AutoBase = %s; want %s", got, want)
+	}
+}
+
+func TestArrayOrder(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i <= 11; i++ {
+		files[fmt.Sprintf("nums[]/%d", i)] = fmt.Sprint(i)
+	}
+	files["neg[]/-1"] = "-1"
+	files["neg[]/2"] = "2"
+	files["neg[]/10@"] = "10"
+	files["mixed[]/item10"] = "10"
+	files["mixed[]/item2"] = "2"
+	files["mixed[]/item1"] = "1"
+	root := writeTree(t, files)
+
+	want := `{"mixed":[1,10,2],"neg":[-1,2,10],"nums":[0,1,2,3,4,5,6,7,8,9,10,11]}`
+	if got := walkJSON(t, root, Options{}); got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+
+	want = `{"mixed":[1,2,10],"neg":[-1,2,10],"nums":[0,1,2,3,4,5,6,7,8,9,10,11]}`
+	if got := walkJSON(t, root, Options{NaturalSort: true}); got != want {
+		t.Errorf("Walk() with NaturalSort = %s; want %s", got, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"item2", "item10", true},
+		{"item10", "item2", false},
+		{"a", "b", true},
+		{"a1b2", "a1b10", true},
+		{"x", "x1", true},
+		{"same", "same", false},
+	}
+	for _, c := range cases {
+		if got := naturalLess(c.a, c.b); got != c.want {
+			t.Errorf("naturalLess(%q, %q) = %t; want %t", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestSymlinkCycle(t *testing.T) {
+	root := writeTree(t, map[string]string{"a/x": "1"})
+	links := map[string]string{
+		"self": ".",    // The root itself
+		"a/up": "..",   // An ancestor of its directory
+		"b":    "a",    // Not a cycle: walked like a
+		"loop": "loop", // A symlink to itself
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skip("unable to create symlinks: ", err)
+		}
+	}
+
+	want := `{"a":{"x":1},"b":{"x":1}}`
+	if got := walkJSON(t, root, Options{FollowSymlinks: true}); got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+
+	// Without FollowSymlinks, symlinks are skipped, so there are no cycles.
+	if got, want := walkJSON(t, root, Options{}), `{"a":{"x":1}}`; got != want {
+		t.Errorf("Walk() without FollowSymlinks = %s; want %s", got, want)
+	}
+
+	if _, err := Walk(root, Options{FollowSymlinks: true, Strict: true}); err == nil {
+		t.Error("Walk() with Strict = nil; want a cycle error")
+	} else if !strings.Contains(err.Error(), "cycle detected") {
+		t.Errorf("Walk() with Strict = %v; want a cycle error", err)
+	}
+}
+
+func TestEmptyFiles(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"zero":     "",
+		"spaces":   "  \n\t\n",
+		"text":     "x",
+		"hint.str": "",
+		"raw@":     `""`,
+	})
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, `{"hint":"","raw":"","spaces":"","text":"x","zero":""}`},
+		{Options{Empty: EmptyNull}, `{"hint":"","raw":"","spaces":null,"text":"x","zero":null}`},
+		{Options{Empty: EmptySkip}, `{"hint":"","raw":"","text":"x"}`},
+		{Options{KeepWhitespace: true}, `{"hint":"","raw":"","spaces":"  \n\t\n","text":"x","zero":""}`},
+		{Options{KeepWhitespace: true, Empty: EmptyNull}, `{"hint":"","raw":"","spaces":"  \n\t\n","text":"x","zero":null}`},
+		{Options{KeepWhitespace: true, Empty: EmptySkip}, `{"hint":"","raw":"","spaces":"  \n\t\n","text":"x"}`},
+	}
+
+	for _, c := range cases {
+		if got := walkJSON(t, root, c.opts); got != c.want {
+			t.Errorf("Walk() with %+v = %s; want %s", c.opts, got, c.want)
+		}
+	}
+}
+
+func TestBOM(t *testing.T) {
+	const bom = "\xEF\xBB\xBF"
+	root := writeTree(t, map[string]string{
+		"bool":     bom + "true\n",
+		"int":      bom + "42",
+		"raw@":     bom + `{"a": [1, 2]}`,
+		"hint.int": bom + "7",
+		"text":     bom + "hello",
+		"mid":      "a" + bom + "b",
+		"blob.b64": bom,
+	})
+
+	want := `{"blob":"77u/","bool":true,"hint":7,"int":42,"mid":"a` + bom + `b","raw":{"a":[1,2]},"text":"hello"}`
+	if got := walkJSON(t, root, Options{}); got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+}
+
+func TestBinaryFiles(t *testing.T) {
+	// The PNG signature is invalid UTF-8 and is followed by the length of the IHDR chunk, which
+	// holds NUL bytes.
+	const png = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	root := writeTree(t, map[string]string{
+		"image.png": png,
+		"nul":       "a\x00b",
+		"text":      "héllo",
+		"hint.str":  "\xff",
+	})
+
+	cases := []struct {
+		mode BinaryMode
+		want string
+	}{
+		{BinaryString, `{"hint":"�","image.png":"�PNG\r\n\u001a\n\u0000\u0000\u0000\rIHDR","nul":"a\u0000b","text":"héllo"}`},
+		{BinaryBase64, `{"hint":"�","image.png":"iVBORw0KGgoAAAANSUhEUg==","nul":"YQBi","text":"héllo"}`},
+		{BinarySkip, `{"hint":"�","text":"héllo"}`},
+	}
+
+	for _, c := range cases {
+		if got := walkJSON(t, root, Options{Binary: c.mode}); got != c.want {
+			t.Errorf("Walk() with Binary = %d = %s; want %s", c.mode, got, c.want)
+		}
+	}
+
+	if _, err := Walk(root, Options{Binary: BinaryError}); err == nil {
+		t.Error("Walk() with BinaryError = nil; want an error")
+	}
+	if !isBinary([]byte(png)) || isBinary([]byte("héllo")) {
+		t.Error("isBinary() didn't detect the PNG header")
+	}
+}
+
+func TestKeywordTokens(t *testing.T) {
+	// Keywords are matched before numbers, including json.Number.
+	for _, useNumber := range []bool{false, true} {
+		opts := Options{TrueTokens: []string{"1", "yes"}, FalseTokens: []string{"0", "no"}, UseNumber: useNumber}
+		testScalars(t, opts, []scalarCase{
+			{"1", `true`},
+			{"0", `false`},
+			{"yes", `true`},
+			{"true", `"true"`},
+			{"2", `2`},
+			{"null", `null`},
+		})
+	}
+}
+
+func TestIntBase(t *testing.T) {
+	cases := []struct {
+		opts Options
+		want []scalarCase
+	}{
+		{Options{}, []scalarCase{{"0755", `"0755"`}, {"0x1F", `"0x1F"`}, {"0b101", `"0b101"`}, {"755", `755`}}},
+		{Options{AutoBase: true}, []scalarCase{{"0755", `493`}, {"0x1F", `31`}, {"0b101", `5`}, {"755", `755`}}},
+		{Options{IntBase: 2}, []scalarCase{{"0755", `"0755"`}, {"0x1F", `"0x1F"`}, {"0b101", `"0b101"`}, {"101", `5`}, {"1.5", `1.5`}}},
+		{Options{IntBase: 8}, []scalarCase{{"0755", `493`}, {"0x1F", `"0x1F"`}, {"0b101", `"0b101"`}, {"755", `493`}, {"-089", `"-089"`}}},
+		{Options{IntBase: 10}, []scalarCase{{"0755", `755`}, {"0x1F", `"0x1F"`}, {"0b101", `"0b101"`}, {"755", `755`}}},
+		{Options{IntBase: 16}, []scalarCase{{"0755", `1877`}, {"0x1F", `"0x1F"`}, {"0b101", `45313`}, {"1F", `31`}}},
+	}
+
+	for _, c := range cases {
+		testScalars(t, c.opts, c.want)
+	}
+
+	// .int files use IntBase too, but fail instead of falling back to a string.
+	root := writeTree(t, map[string]string{"mode.int": "0755"})
+	if got, want := walkJSON(t, root, Options{IntBase: 8}), `{"mode":493}`; got != want {
+		t.Errorf("Walk() with IntBase = 8 = %s; want %s", got, want)
+	}
+	if _, err := Walk(root, Options{IntBase: 2}); err == nil {
+		t.Error("Walk() with IntBase = 2 = nil; want an error for 0755")
+	}
+	if _, err := Walk(root, Options{IntBase: 37}); err == nil {
+		t.Error("Walk() with IntBase = 37 = nil; want an error")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	testScalars(t, Options{ParseTime: true}, []scalarCase{
+		{"2024-03-01T09:30:00-05:00", `"2024-03-01T14:30:00Z"`},
+		{"2024-03-01T14:30:00.5Z", `"2024-03-01T14:30:00.5Z"`},
+		{"2024-03-01 09:30:00", `"2024-03-01T09:30:00Z"`},
+		{"2024-03-01", `"2024-03-01T00:00:00Z"`},
+		{"Fri, 01 Mar 2024 09:30:00 -0500", `"2024-03-01T14:30:00Z"`},
+		{"2024-13-01", `"2024-13-01"`},
+		{"2024-02-30T00:00:00Z", `"2024-02-30T00:00:00Z"`},
+		{"yesterday", `"yesterday"`},
+		{"20240301", `20240301`},
+	})
+
+	// Without ParseTime, times are left as they're written.
+	testScalars(t, Options{}, []scalarCase{
+		{"2024-03-01T09:30:00-05:00", `"2024-03-01T09:30:00-05:00"`},
+	})
+
+	// Times with a leading zero are still times, even though numbers with one are strings.
+	testScalars(t, Options{ParseTime: true, TimeLayouts: []string{"01/02/2006", "15:04"}}, []scalarCase{
+		{"03/01/2024", `"2024-03-01T00:00:00Z"`},
+		{"09:30", `"0000-01-01T09:30:00Z"`},
+		{"2024-03-01", `"2024-03-01"`},
+		{"0123", `"0123"`},
+	})
+
+	// .time files always parse times, and fail if they can't.
+	root := writeTree(t, map[string]string{"start.time": "2024-03-01 09:30:00-05:00\n"})
+	if got, want := walkJSON(t, root, Options{}), `{"start":"2024-03-01T14:30:00Z"}`; got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+	root = writeTree(t, map[string]string{"start.time": "not a time"})
+	if _, err := Walk(root, Options{}); err == nil {
+		t.Error("Walk() = nil; want an error for an invalid .time file")
+	}
+}
+
+func TestNumUnderscore(t *testing.T) {
+	testScalars(t, Options{}, []scalarCase{
+		{"1_000", `"1_000"`},
+		{"1_000.5", `"1_000.5"`},
+		{"_100", `"_100"`},
+		{"1__0", `"1__0"`},
+		{"1000", `1000`},
+	})
+
+	testScalars(t, Options{NumUnderscore: true}, []scalarCase{
+		{"1_000", `1000`},
+		{"1_000.5", `1000.5`},
+		{"_100", `"_100"`},
+		{"100_", `"100_"`},
+		{"1__0", `"1__0"`},
+		{"1_000_000", `1000000`},
+	})
+
+	testScalars(t, Options{NumUnderscore: true, IntBase: 16}, []scalarCase{
+		{"ff_ff", `65535`},
+		{"_ff", `"_ff"`},
+		{"f__f", `"f__f"`},
+	})
+
+	root := writeTree(t, map[string]string{"n.int": "1_000", "f.float": "1_000.5"})
+	if got, want := walkJSON(t, root, Options{NumUnderscore: true}), `{"f":1000.5,"n":1000}`; got != want {
+		t.Errorf("Walk() with NumUnderscore = %s; want %s", got, want)
+	}
+	if _, err := Walk(root, Options{}); err == nil {
+		t.Error("Walk() without NumUnderscore = nil; want an error for .int and .float files with underscores")
+	}
+}
+
+func TestPreserveLeadingZero(t *testing.T) {
+	// Leading zeros are preserved by default, which -preserve-leading-zero=false turns off by
+	// setting AutoBase.
+	testScalars(t, Options{}, []scalarCase{
+		{"0", `0`},
+		{"01", `"01"`},
+		{"007", `"007"`},
+		{"0.5", `0.5`},
+		{"00.5", `"00.5"`},
+		{"01234", `"01234"`},
+	})
+
+	testScalars(t, Options{AutoBase: true}, []scalarCase{
+		{"0", `0`},
+		{"01", `1`},
+		{"007", `7`},
+		{"0.5", `0.5`},
+		{"00.5", `0.5`},
+	})
+}
+
+func TestBase64(t *testing.T) {
+	const png = "\x89PNG\r\n\x1a\n"
+	root := writeTree(t, map[string]string{
+		"motd.b64@":       "aGVsbG8=\n",
+		"wrapped.b64@":    "aGVs\nbG8",
+		"port.int.b64@":   "ODA4MA==",
+		"raw@.b64@":       "eyJhIjogMX0=",
+		"image.png.b64":   png,
+		"image2.b64@":     "iVBORw0KGgo=",
+		"dir.b64@/x":      "1",
+		"encoded.b64":     "hello",
+		"not.b64@.b64@":   "ZEdWNGRBPT0=",
+		"plain.b64.yaml@": `"aGk="`,
+	})
+
+	want := `{"dir.b64":{"x":1},"encoded":"aGVsbG8=","image.png":"iVBORw0KGgo=","image2":"iVBORw0KGgo=",` +
+		`"motd":"hello","not":"text","plain.b64":"aGk=","port":8080,"raw":{"a":1},"wrapped":"hello"}`
+	if got := walkJSON(t, root, Options{Binary: BinaryBase64}); got != want {
+		t.Errorf("Walk() = %s; want %s", got, want)
+	}
+
+	root = writeTree(t, map[string]string{"bad.b64@": "not base64!"})
+	if _, err := Walk(root, Options{}); err == nil || !strings.Contains(err.Error(), "invalid base64") {
+		t.Errorf("Walk() = %v; want an invalid base64 error", err)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	gz := func(s string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.String()
+	}
+	root := writeTree(t, map[string]string{
+		"payload.json@.gz": gz(`{"a": 1}`),
+		"port.int.gz":      gz("42"),
+		"plain.gz":         gz("hi\n"),
+		"text.txt":         "hi",
+	})
+
+	want := `{"payload.json":{"a":1},"plain":"hi","port":42,"text.txt":"hi"}`
+	if got := walkJSON(t, root, Options{Gzip: true}); got != want {
+		t.Errorf("Walk() with Gzip = %s; want %s", got, want)
+	}
+	want = `{"payload":{"a":1},"plain":"hi","port":42,"text":"hi"}`
+	if got := walkJSON(t, root, Options{Gzip: true, StripExt: true}); got != want {
+		t.Errorf("Walk() with Gzip and StripExt = %s; want %s", got, want)
+	}
+
+	// MaxSize applies to the decompressed contents as well as the file.
+	root = writeTree(t, map[string]string{
+		"big.gz":      gz(strings.Repeat("a", 1000)),
+		"port.int.gz": gz("42"),
+	})
+	want = `{"port":42}`
+	if got := walkJSON(t, root, Options{Gzip: true, MaxSize: 100}); got != want {
+		t.Errorf("Walk() with Gzip and MaxSize = %s; want %s", got, want)
+	}
+
+	root = writeTree(t, map[string]string{"bad.gz": "not gzip"})
+	if _, err := Walk(root, Options{Gzip: true}); err == nil || !strings.Contains(err.Error(), "invalid gzip") {
+		t.Errorf("Walk() = %v; want an invalid gzip error", err)
+	}
+	if got, want := walkJSON(t, root, Options{}), `{"bad.gz":"not gzip"}`; got != want {
+		t.Errorf("Walk() without Gzip = %s; want %s", got, want)
+	}
+}
+
+func TestHex(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a.hex": "ff\n",
+		"b.hex": "0xFF",
+		"c.hex": "00ff",
+		"d.hex": "-0x80",
+		"e":     "0xFF",
+	})
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, `{"a":255,"b":255,"c":255,"d":-128,"e":"0xFF"}`},
+		{Options{IntBase: 10}, `{"a":255,"b":255,"c":255,"d":-128,"e":"0xFF"}`},
+		{Options{AutoBase: true}, `{"a":255,"b":255,"c":255,"d":-128,"e":255}`},
+		{Options{HexStrings: true}, `{"a":"ff","b":"0xFF","c":"00ff","d":"-0x80","e":"0xFF"}`},
+		{Options{HexStrings: true, AutoBase: true}, `{"a":"ff","b":"0xFF","c":"00ff","d":"-0x80","e":"0xFF"}`},
+	}
+	for _, c := range cases {
+		if got := walkJSON(t, root, c.opts); got != c.want {
+			t.Errorf("Walk() with %+v = %s; want %s", c.opts, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"zz", "0x", "", "0x_1", "1_0", "+-1", "10000000000000000"} {
+		if v, ok := parseHex(bad); ok {
+			t.Errorf("parseHex(%q) = %d; want an error", bad, v)
+		}
+	}
+}
@@ -0,0 +1,662 @@
+package jsondir
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlDecoder decodes a single YAML document into the values Walk produces: nil, bool, int64,
+// float64, string, []interface{}, and map[string]interface{}. It understands block and flow
+// collections, plain, quoted, and block scalars, and comments. Anchors, aliases, tags, complex
+// keys, and multiple documents aren't supported.
+type yamlDecoder struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlLine is a line of a YAML document.
+type yamlLine struct {
+	num    int    // The line's number, starting at 1
+	raw    string // The line without its line ending
+	indent int    // The number of spaces before text
+	text   string // The line without indentation or trailing whitespace
+}
+
+// blank returns whether the line is empty or only a comment.
+func (l yamlLine) blank() bool {
+	text := strings.TrimLeft(l.text, "\t")
+	return text == "" || text[0] == '#'
+}
+
+// marker returns whether the line is a document marker, "---" or "...", which ends any scalar or
+// flow collection before it.
+func (l yamlLine) marker() bool {
+	return l.indent == 0 && (l.text == "..." || l.text == "---" || strings.HasPrefix(l.text, "--- "))
+}
+
+// yamlError is an error decoding a YAML document.
+type yamlError struct {
+	line int
+	msg  string
+}
+
+func (e *yamlError) Error() string {
+	return fmt.Sprintf("invalid YAML: line %d: %s", e.line, e.msg)
+}
+
+// decodeYAML decodes the YAML document in data. An empty document is null.
+func decodeYAML(data []byte) (v interface{}, err error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("invalid YAML: not valid UTF-8")
+	}
+
+	// A final line ending doesn't start another line.
+	d := &yamlDecoder{}
+	for i, raw := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		raw = strings.TrimSuffix(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		d.lines = append(d.lines, yamlLine{
+			num:    i + 1,
+			raw:    raw,
+			indent: len(raw) - len(text),
+			text:   strings.TrimRight(text, " \t"),
+		})
+	}
+
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case *yamlError:
+			v, err = nil, r
+		default:
+			panic(r)
+		}
+	}()
+	return d.document(), nil
+}
+
+// fail stops decoding with an error at line.
+func (d *yamlDecoder) fail(line int, format string, args ...interface{}) {
+	panic(&yamlError{line: line, msg: fmt.Sprintf(format, args...)})
+}
+
+// next skips blank lines and returns the next line, and whether there is one. The end of the
+// document, "...", is the end of the lines.
+func (d *yamlDecoder) next() (*yamlLine, bool) {
+	for ; d.pos < len(d.lines); d.pos++ {
+		l := &d.lines[d.pos]
+		if l.blank() {
+			continue
+		}
+		if l.indent == 0 && l.text == "..." {
+			return nil, false
+		}
+		if strings.HasPrefix(strings.TrimLeft(l.raw, " "), "\t") {
+			d.fail(l.num, "tabs aren't allowed in indentation")
+		}
+		return l, true
+	}
+	return nil, false
+}
+
+func (d *yamlDecoder) document() interface{} {
+	l, ok := d.next()
+	if ok && l.indent == 0 && strings.HasPrefix(l.text, "%") {
+		d.fail(l.num, "directives aren't supported")
+	}
+	if ok && l.indent == 0 && strings.HasPrefix(l.text, "--- ") {
+		d.fail(l.num, "content after \"---\" isn't supported")
+	} else if ok && l.indent == 0 && l.text == "---" {
+		d.pos++
+		l, ok = d.next()
+	}
+	if !ok {
+		return nil
+	}
+
+	v := d.block(l.indent)
+	if l, ok := d.next(); ok {
+		if l.indent == 0 && l.text == "---" {
+			d.fail(l.num, "multiple documents aren't supported")
+		}
+		d.fail(l.num, "unexpected content")
+	}
+	return v
+}
+
+// block decodes the node starting at the current line, which is indented by indent.
+func (d *yamlDecoder) block(indent int) interface{} {
+	l, _ := d.next()
+	switch {
+	case isYAMLSeqEntry(l.text):
+		return d.sequence(indent)
+	case d.mapKey(l) >= 0:
+		return d.mapping(indent)
+	}
+	d.pos++
+	return d.inline(l, l.text, indent-1)
+}
+
+// isYAMLSeqEntry returns whether text is an entry of a block sequence.
+func isYAMLSeqEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ") || strings.HasPrefix(text, "-\t")
+}
+
+// mapKey returns the index of the colon ending the key of a block mapping entry in l, or -1 if l
+// isn't a mapping entry.
+func (d *yamlDecoder) mapKey(l *yamlLine) int {
+	text := l.text
+	switch text[0] {
+	case '"', '\'':
+		_, n := d.quoted(l, text)
+		if rest := text[n:]; rest == ":" || strings.HasPrefix(rest, ": ") || strings.HasPrefix(rest, ":\t") {
+			return n
+		}
+		return -1
+	case '[', '{', '#', '|', '>', '&', '*', '!':
+		return -1
+	case '?':
+		if text == "?" || strings.HasPrefix(text, "? ") {
+			d.fail(l.num, "complex keys aren't supported")
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '#' && i > 0 && (text[i-1] == ' ' || text[i-1] == '\t'):
+			return -1
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t'):
+			if i == 0 {
+				d.fail(l.num, "empty keys aren't supported")
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// key returns the key of the mapping entry in l whose colon is at i.
+func (d *yamlDecoder) key(l *yamlLine, i int) string {
+	text := l.text[:i]
+	if text == "" {
+		d.fail(l.num, "empty keys aren't supported")
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		s, _ := d.quoted(l, text)
+		return s
+	}
+	return strings.TrimRight(text, " \t")
+}
+
+func (d *yamlDecoder) mapping(indent int) interface{} {
+	m := make(map[string]interface{})
+	for {
+		l, ok := d.next()
+		if !ok || l.indent < indent || l.indent == 0 && l.text == "---" {
+			return m
+		} else if l.indent > indent {
+			d.fail(l.num, "unexpected indentation")
+		}
+
+		i := d.mapKey(l)
+		if i < 0 {
+			d.fail(l.num, "expected a mapping entry")
+		}
+		key := d.key(l, i)
+		if _, ok := m[key]; ok {
+			d.fail(l.num, "duplicate key %q", key)
+		}
+		d.pos++
+		m[key] = d.value(l, strings.TrimLeft(l.text[i+1:], " \t"), indent, true)
+	}
+}
+
+func (d *yamlDecoder) sequence(indent int) interface{} {
+	s := []interface{}{}
+	for {
+		l, ok := d.next()
+		if !ok || l.indent < indent || l.indent == 0 && l.text == "---" {
+			return s
+		} else if l.indent > indent {
+			d.fail(l.num, "unexpected indentation")
+		} else if !isYAMLSeqEntry(l.text) {
+			return s
+		}
+
+		rest := strings.TrimLeft(l.text[1:], " \t")
+		if rest != "" && rest[0] != '#' && (isYAMLSeqEntry(rest) || d.mapKey(&yamlLine{num: l.num, text: rest}) >= 0) {
+			// A nested collection starting on the same line as its entry: decode it as if it
+			// started on a line of its own, indented to where it starts.
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			s = append(s, d.block(l.indent))
+			continue
+		}
+		d.pos++
+		s = append(s, d.value(l, rest, indent, false))
+	}
+}
+
+// value decodes the value of a mapping or sequence entry, given the rest of its line after the key
+// or dash, where the entry is in a collection indented by indent.
+func (d *yamlDecoder) value(l *yamlLine, rest string, indent int, inMap bool) interface{} {
+	if rest != "" && rest[0] != '#' {
+		return d.inline(l, rest, indent)
+	}
+
+	next, ok := d.next()
+	switch {
+	case !ok:
+		return nil
+	case next.indent > indent:
+		return d.block(next.indent)
+	case inMap && next.indent == indent && isYAMLSeqEntry(next.text):
+		// Sequences may be indented as far as the key they belong to.
+		return d.sequence(indent)
+	}
+	return nil
+}
+
+// inline decodes a value that starts in text, on the line l, and continues on following lines
+// indented by more than indent.
+func (d *yamlDecoder) inline(l *yamlLine, text string, indent int) interface{} {
+	switch text[0] {
+	case '|', '>':
+		return d.blockScalar(l, text, indent)
+	case '&', '*':
+		d.fail(l.num, "anchors and aliases aren't supported")
+	case '!':
+		d.fail(l.num, "tags aren't supported")
+	case '@', '`':
+		d.fail(l.num, "plain scalars can't start with %q", text[0])
+	}
+
+	if text[0] == '[' || text[0] == '{' {
+		// Flow collections continue until they're closed, with their lines kept intact so that
+		// comments end at the end of their line.
+		for flowDepth(text) > 0 && d.pos < len(d.lines) && !d.lines[d.pos].marker() {
+			text += "\n" + strings.TrimSpace(d.lines[d.pos].raw)
+			d.pos++
+		}
+	} else {
+		// Fold continuation lines into text with spaces, as YAML does.
+		plain := text[0] != '"' && text[0] != '\''
+		for d.pos < len(d.lines) {
+			next := d.lines[d.pos]
+			if next.blank() && plain || next.text == "" || next.indent <= indent || next.marker() {
+				break
+			}
+			if plain && d.mapKey(&next) >= 0 {
+				d.fail(next.num, "unexpected mapping entry in a plain scalar")
+			}
+			text += " " + next.text
+			d.pos++
+		}
+	}
+
+	var v interface{}
+	var n int
+	switch text[0] {
+	case '"', '\'':
+		v, n = d.quoted(l, text)
+	case '[', '{':
+		f := &yamlFlow{d: d, line: l.num, s: text}
+		v = f.value()
+		n = f.pos
+	default:
+		s := stripYAMLComment(text)
+		return yamlScalar(d, l.num, s)
+	}
+
+	if rest := strings.TrimLeft(text[n:], " \t\n"); rest != "" && rest[0] != '#' {
+		d.fail(l.num, "unexpected %q after value", rest)
+	}
+	return v
+}
+
+// flowDepth returns how many flow collections are left open at the end of s.
+func flowDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == '#' && i > 0 && (s[i-1] == ' ' || s[i-1] == '\t'):
+			if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(s)
+			}
+		}
+	}
+	return depth
+}
+
+// stripYAMLComment returns the plain scalar s without a trailing comment.
+func stripYAMLComment(s string) string {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '#' && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return s
+}
+
+// blockScalar decodes a literal (|) or folded (>) block scalar with the header text, in a
+// collection indented by indent.
+func (d *yamlDecoder) blockScalar(l *yamlLine, text string, indent int) interface{} {
+	folded := text[0] == '>'
+	chomp, explicit := byte(0), 0
+	header := stripYAMLComment(text[1:])
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+		case c >= '1' && c <= '9' && explicit == 0:
+			explicit = int(c - '0')
+		default:
+			d.fail(l.num, "invalid block scalar header %q", text)
+		}
+	}
+
+	contentIndent := -1
+	if explicit > 0 {
+		contentIndent = indent + explicit
+		if indent < 0 {
+			contentIndent = explicit
+		}
+	}
+
+	var lines []string
+	for ; d.pos < len(d.lines); d.pos++ {
+		next := d.lines[d.pos]
+		if next.marker() {
+			break
+		} else if strings.TrimSpace(next.raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if contentIndent < 0 {
+			if next.indent <= indent {
+				break
+			}
+			contentIndent = next.indent
+		}
+		if next.indent < contentIndent {
+			break
+		}
+		lines = append(lines, next.raw[contentIndent:])
+	}
+
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case !folded, prev == "" || isMoreIndented(prev) || isMoreIndented(line):
+				sb.WriteByte('\n')
+			case line != "":
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(line)
+	}
+
+	switch {
+	case sb.Len() == 0 && chomp != '+':
+	case chomp == '-':
+	case chomp == '+':
+		sb.WriteString(strings.Repeat("\n", trailing+1))
+	default:
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// isMoreIndented returns whether a line of a folded block scalar is indented more than the
+// others, which keeps it from being folded.
+func isMoreIndented(line string) bool {
+	return line != "" && (line[0] == ' ' || line[0] == '\t')
+}
+
+// quoted decodes the quoted scalar at the start of text, on the line l, and returns it and its
+// length in text.
+func (d *yamlDecoder) quoted(l *yamlLine, text string) (string, int) {
+	q := text[0]
+	var sb strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			sb.WriteByte('\'')
+			i++
+		case c == q:
+			return sb.String(), i + 1
+		case c == '\\' && q == '"':
+			n := d.escape(l, text[i:], &sb)
+			i += n - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	d.fail(l.num, "unterminated quoted string")
+	return "", 0
+}
+
+// escape decodes the escape sequence at the start of s into sb and returns its length.
+func (d *yamlDecoder) escape(l *yamlLine, s string, sb *strings.Builder) int {
+	if len(s) < 2 {
+		d.fail(l.num, "invalid escape sequence")
+	}
+
+	if r, ok := yamlEscapes[s[1]]; ok {
+		sb.WriteString(r)
+		return 2
+	}
+
+	size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[1]]
+	if size == 0 || len(s) < 2+size {
+		d.fail(l.num, "invalid escape sequence %q", s[:2])
+	}
+	n, err := strconv.ParseUint(s[2:2+size], 16, 32)
+	if err != nil || n > utf8.MaxRune {
+		d.fail(l.num, "invalid escape sequence %q", s[:2+size])
+	}
+	sb.WriteRune(rune(n))
+	return 2 + size
+}
+
+// yamlEscapes are the single-character escape sequences of double-quoted scalars.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f",
+	'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\", 'N': "\u0085",
+	'_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+	yamlInf   = regexp.MustCompile(`^[-+]?\.(inf|Inf|INF)$|^\.(nan|NaN|NAN)$`)
+)
+
+// yamlScalar resolves the plain scalar s, on line num, to a value using the YAML 1.2 core schema.
+func yamlScalar(d *yamlDecoder, num int, s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	switch {
+	case yamlInt.MatchString(s):
+		if i64, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i64
+		}
+	case strings.HasPrefix(s, "0x"):
+		if i64, err := strconv.ParseInt(s[2:], 16, 64); err == nil {
+			return i64
+		}
+	case strings.HasPrefix(s, "0o"):
+		if i64, err := strconv.ParseInt(s[2:], 8, 64); err == nil {
+			return i64
+		}
+	case yamlInf.MatchString(s):
+		d.fail(num, "%s can't be represented in JSON", s)
+	}
+
+	if yamlFloat.MatchString(s) {
+		if f64, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f64, 0) {
+			return f64
+		}
+	}
+	return s
+}
+
+// yamlFlow decodes a flow collection, which may span lines joined by spaces.
+type yamlFlow struct {
+	d    *yamlDecoder
+	line int
+	s    string
+	pos  int
+}
+
+// skip skips whitespace, line breaks, and comments.
+func (f *yamlFlow) skip() {
+	for f.pos < len(f.s) {
+		switch f.s[f.pos] {
+		case ' ', '\t', '\n':
+			f.pos++
+		case '#':
+			if end := strings.IndexByte(f.s[f.pos:], '\n'); end >= 0 {
+				f.pos += end
+			} else {
+				f.pos = len(f.s)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (f *yamlFlow) peek() byte {
+	f.skip()
+	if f.pos >= len(f.s) {
+		f.d.fail(f.line, "unterminated flow collection")
+	}
+	return f.s[f.pos]
+}
+
+func (f *yamlFlow) value() interface{} {
+	switch f.peek() {
+	case '[':
+		f.pos++
+		s := []interface{}{}
+		for f.peek() != ']' {
+			s = append(s, f.value())
+			if !f.comma() {
+				break
+			}
+		}
+		f.expect(']')
+		return s
+	case '{':
+		f.pos++
+		m := make(map[string]interface{})
+		for f.peek() != '}' {
+			key := f.scalar()
+			k, ok := key.(string)
+			if !ok {
+				k = fmt.Sprint(key)
+				if key == nil {
+					k = "null"
+				}
+			}
+			if _, ok := m[k]; ok {
+				f.d.fail(f.line, "duplicate key %q", k)
+			}
+			var v interface{}
+			if f.peek() == ':' {
+				f.pos++
+				if c := f.peek(); c != ',' && c != '}' {
+					v = f.value()
+				}
+			}
+			m[k] = v
+			if !f.comma() {
+				break
+			}
+		}
+		f.expect('}')
+		return m
+	}
+	return f.scalar()
+}
+
+// comma consumes a comma separating entries of a collection, and returns whether there is one.
+func (f *yamlFlow) comma() bool {
+	if f.peek() == ',' {
+		f.pos++
+		return true
+	}
+	return false
+}
+
+func (f *yamlFlow) expect(c byte) {
+	if f.peek() != c {
+		f.d.fail(f.line, "expected %q in flow collection", c)
+	}
+	f.pos++
+}
+
+// scalar decodes a scalar in a flow collection. Plain scalars end at a colon followed by a space,
+// as in a key, or at an indicator that ends an entry.
+func (f *yamlFlow) scalar() interface{} {
+	switch c := f.peek(); c {
+	case '"', '\'':
+		s, n := f.d.quoted(&yamlLine{num: f.line}, f.s[f.pos:])
+		f.pos += n
+		return s
+	case '[', '{':
+		f.d.fail(f.line, "flow collections can't be keys")
+	case '&', '*':
+		f.d.fail(f.line, "anchors and aliases aren't supported")
+	case '!':
+		f.d.fail(f.line, "tags aren't supported")
+	}
+
+	start := f.pos
+	for ; f.pos < len(f.s); f.pos++ {
+		c := f.s[f.pos]
+		if c == ',' || c == ']' || c == '}' || c == '\n' || c == '#' && (f.s[f.pos-1] == ' ' || f.s[f.pos-1] == '\t') {
+			break
+		}
+		if c == ':' && (f.pos+1 == len(f.s) || strings.IndexByte(" \t,]}", f.s[f.pos+1]) >= 0) {
+			break
+		}
+	}
+	return yamlScalar(f.d, f.line, strings.TrimRight(f.s[start:f.pos], " \t"))
+}
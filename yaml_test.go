@@ -0,0 +1,118 @@
+package jsondir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Scalars
+		{"empty", "", `null`},
+		{"null", "~", `null`},
+		{"true", "True", `true`},
+		{"false", "FALSE", `false`},
+		{"int", "42", `42`},
+		{"negative int", "-7", `-7`},
+		{"hex int", "0x1F", `31`},
+		{"octal int", "0o17", `15`},
+		{"float", "1.5", `1.5`},
+		{"exponent", "1e3", `1000`},
+		{"plain string", "hello world", `"hello world"`},
+		{"yes is a string", "yes", `"yes"`},
+		{"leading zero", "007", `7`},
+		{"single quoted", "'it''s'", `"it's"`},
+		{"double quoted", `"a\tb\n\u00e9\x41"`, `"a\tb\néA"`},
+		{"quoted keyword", `"true"`, `"true"`},
+		{"document marker", "---\nfoo\n...\nignored", `"foo"`},
+
+		// Block collections
+		{"mapping", "a: 1\nb: two\nc:\n", `{"a":1,"b":"two","c":null}`},
+		{"quoted empty key", "\"\": 1", `{"":1}`},
+		{"nested mapping", "a:\n  b:\n    c: 1\n  d: 2\ne: 3", `{"a":{"b":{"c":1},"d":2},"e":3}`},
+		{"sequence", "- 1\n- two\n- ", `[1,"two",null]`},
+		{"sequence in mapping", "a:\n- 1\n- 2\nb:\n  - 3", `{"a":[1,2],"b":[3]}`},
+		{"mapping in sequence", "- a: 1\n  b: 2\n- c: 3", `[{"a":1,"b":2},{"c":3}]`},
+		{"nested sequence", "- - 1\n  - 2\n- 3", `[[1,2],3]`},
+		{"quoted keys", "\"a b\": 1\n'c:d': 2", `{"a b":1,"c:d":2}`},
+		{"colon in value", "url: http://example.com", `{"url":"http://example.com"}`},
+
+		// Flow collections
+		{"flow sequence", "[1, two, 'three', [4]]", `[1,"two","three",[4]]`},
+		{"flow mapping", "{a: 1, b: [2, 3], c: {d: e}}", `{"a":1,"b":[2,3],"c":{"d":"e"}}`},
+		{"empty flow", "a: []\nb: {}", `{"a":[],"b":{}}`},
+		{"multi-line flow", "a: [1,\n  2,\n  3]", `{"a":[1,2,3]}`},
+		{"JSON", `{"a": [1, 2.5, "x\"y"], "b": null}`, `{"a":[1,2.5,"x\"y"],"b":null}`},
+
+		// Multi-line strings
+		{"literal", "a: |\n  one\n  two\nb: 1", `{"a":"one\ntwo\n","b":1}`},
+		{"folded", "a: >\n  one\n  two\n\n  three\n", `{"a":"one two\nthree\n"}`},
+		{"strip", "a: |-\n  one\n", `{"a":"one"}`},
+		{"keep", "a: |+\n  one\n\n", `{"a":"one\n\n"}`},
+		{"indentation indicator", "a: |2\n    one\n  two\n", `{"a":"  one\ntwo\n"}`},
+		{"plain multi-line", "a: one\n  two\n  three", `{"a":"one two three"}`},
+
+		// Comments
+		{"comments", "# head\na: 1 # one\n# between\nb: '# not a comment'\n", `{"a":1,"b":"# not a comment"}`},
+		{"hash in plain", "a: b#c", `{"a":"b#c"}`},
+		{"comment in flow", "[1, # one\n 2]", `[1,2]`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := decodeYAML([]byte(c.in))
+			if err != nil {
+				t.Fatalf("decodeYAML(%q) = %v", c.in, err)
+			}
+			if got := toJSON(t, v); got != c.want {
+				t.Errorf("decodeYAML(%q) = %s; want %s", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"anchor", "a: &x 1\nb: *x", "line 1"},
+		{"alias", "a: *x", "line 1"},
+		{"tag", "a: !!str 1", "line 1"},
+		{"multiple documents", "a: 1\n---\nb: 2", "line 2"},
+		{"unterminated quote", "a: \"b", "line 1"},
+		{"invalid escape", `a: "\q"`, "line 1"},
+		{"unterminated flow", "a: [1, 2", ""},
+		{"bad indentation", "a: 1\n  b: 2", "line 2"},
+		{"duplicate key", "a: 1\na: 2", "line 2"},
+		{"infinity", "a: .inf", "line 1"},
+		{"empty nested key", "a:\n  :\n", "line 2"},
+		{"empty key", ": 1", "line 1"},
+		{"empty key in sequence", "- : 1", "line 1"},
+		{"unterminated quoted key", "\"a: 1", "line 1"},
+		{"tab indentation", "a:\n\tb: 1", "line 2"},
+		{"unexpected content", "- a\nb: 1", "line 2"},
+		{"mapping in plain scalar", "a: b\n  c: d", "line 2"},
+		{"complex key", "? a\n: b", "line 1"},
+		{"directive", "%YAML 1.2\n---\na: 1", "line 1"},
+		{"trailing content after quote", "a: \"b\" c", "line 1"},
+		{"invalid block scalar header", "a: |x\n  b", "line 1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := decodeYAML([]byte(c.in))
+			if err == nil {
+				t.Fatalf("decodeYAML(%q) = %s; want an error", c.in, toJSON(t, v))
+			}
+			if !strings.Contains(err.Error(), c.err) {
+				t.Errorf("decodeYAML(%q) = %v; want an error containing %q", c.in, err, c.err)
+			}
+		})
+	}
+}